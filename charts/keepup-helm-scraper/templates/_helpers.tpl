@@ -60,3 +60,38 @@ Create the name of the service account to use
 {{- default "default" .Values.serviceAccount.name }}
 {{- end }}
 {{- end }}
+
+{{/*
+Pod spec of the scraper, run by the CronJob or, with MODE interval, the Deployment
+*/}}
+{{- define "helm-scraper.podSpec" -}}
+{{- if .Values.rbac.create }}
+serviceAccountName: {{ .Release.Name }}
+{{- end }}
+containers:
+  - name: helm-scraper
+    image: "{{ .Values.image.repository }}:{{ .Values.image.tag | default .Chart.AppVersion }}"
+    imagePullPolicy: "{{ .Values.image.pullPolicy }}"
+    envFrom:
+      - secretRef:
+          name: {{ .Release.Name }}
+    volumeMounts:
+      {{- if not (regexMatch "^https?://" .Values.env.RULES_FILE) }}
+      - name: config
+        mountPath: "{{ .Values.env.RULES_FILE }}"
+        subPath: rules.yaml
+      {{- end }}
+      {{- if .Values.spool.existingClaim }}
+      - name: spool
+        mountPath: "{{ .Values.env.SPOOL_DIR }}"
+      {{- end }}
+volumes:
+  - name: config
+    configMap:
+      name: {{ .Release.Name }}
+  {{- if .Values.spool.existingClaim }}
+  - name: spool
+    persistentVolumeClaim:
+      claimName: {{ .Values.spool.existingClaim }}
+  {{- end }}
+{{- end }}
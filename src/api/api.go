@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"keepup-helm-scraper/src/config"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrRejected is wrapped by the errors of payloads the API rejected for good,
+// f/e with a 400, which sending the same payload again doesn't fix.
+var ErrRejected = errors.New("rejected by the API")
+
+// SendData sends the JSON payload to API_URL, retrying failed attempts
+// as configured by the API_RETRY_* variables. It returns the error of
+// the last attempt.
+func SendData(jsonData []byte) error {
+	cfg := config.GetEnvConfig()
+
+	if cfg.API_URL == "" || !hasToken() {
+		log.Println("API_URL or API_TOKEN not set, skipping API request")
+		return nil
+	}
+
+	token, err := apiToken()
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return fmt.Errorf("failed to configure API client: %w", err)
+	}
+
+	return retry(cfg, func() (bool, error) {
+		return send(client, cfg.API_URL, token, jsonData)
+	})
+}
+
+// sleep waits between the attempts of retry, replaced by tests.
+var sleep = time.Sleep
+
+// retry makes the attempts of a request until one succeeds, fails for good
+// or API_MAX_RETRIES are used up, waiting as API_RETRY_STRATEGY says.
+func retry(cfg config.EnvConfig, attempt func() (bool, error)) error {
+	for n := 0; ; n++ {
+		retryable, err := attempt()
+		if err == nil {
+			log.Println("Successfully sent data to API")
+			return nil
+		}
+		if !retryable || n >= cfg.API_MAX_RETRIES {
+			return err
+		}
+
+		delay := retryDelay(cfg.API_RETRY_STRATEGY, cfg.API_RETRY_BASE_MS, n)
+		log.Printf("Failed to send data to API: %v, retrying in %s", err, delay)
+		sleep(delay)
+	}
+}
+
+// Probe checks that API_URL is reachable with a HEAD request, sending no data.
+// Any HTTP response counts, as the API may not implement HEAD. With gRPC
+// it connects to API_URL instead.
+func Probe() error {
+	cfg := config.GetEnvConfig()
+	if cfg.API_URL == "" {
+		return fmt.Errorf("API_URL not set")
+	}
+	if cfg.API_TRANSPORT == config.TransportGRPC {
+		return probeGRPC()
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodHead, cfg.API_URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", cfg.UserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("API responded with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// CanStream reports whether StreamData can send the report, or else why
+// the payload has to be buffered.
+func CanStream() (bool, string) {
+	cfg := config.GetEnvConfig()
+	switch {
+	case cfg.API_TRANSPORT != config.TransportHTTP:
+		return false, "API_TRANSPORT isn't http"
+	case cfg.PAYLOAD_TEMPLATE != "":
+		return false, "PAYLOAD_TEMPLATE renders the whole payload"
+	case len(cfg.PAYLOAD_FIELD_MAP) > 0:
+		return false, "PAYLOAD_FIELD_MAP renames the fields of the whole payload"
+	case cfg.API_HMAC_SECRET != "":
+		return false, "API_HMAC_SECRET signs the whole payload"
+	case cfg.API_IDEMPOTENCY_HEADER != "":
+		return false, "API_IDEMPOTENCY_HEADER hashes the whole payload"
+	}
+	return true, ""
+}
+
+// StreamData sends the report to API_URL like SendData, but encodes it as
+// JSON straight into a chunked request body instead of marshaling it first,
+// so the payload of a large cluster isn't held in memory besides the report.
+// Check CanStream before.
+func StreamData(report any) error {
+	cfg := config.GetEnvConfig()
+
+	if cfg.API_URL == "" || !hasToken() {
+		log.Println("API_URL or API_TOKEN not set, skipping API request")
+		return nil
+	}
+
+	token, err := apiToken()
+	if err != nil {
+		return err
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return fmt.Errorf("failed to configure API client: %w", err)
+	}
+
+	return retry(cfg, func() (bool, error) {
+		// the client closes the body on failures, which stops the encoding
+		body, w := io.Pipe()
+		go func() {
+			w.CloseWithError(json.NewEncoder(w).Encode(report))
+		}()
+
+		req, err := newRequest(cfg.API_URL, token, body)
+		if err != nil {
+			body.Close()
+			return false, err
+		}
+		return do(client, req)
+	})
+}
+
+// send makes a single request and reports whether a failure is worth retrying.
+func send(client *http.Client, apiURL, apiToken string, jsonData []byte) (bool, error) {
+	cfg := config.GetEnvConfig()
+	req, err := newRequest(apiURL, apiToken, bytes.NewReader(jsonData))
+	if err != nil {
+		return false, err
+	}
+
+	if cfg.API_HMAC_SECRET != "" {
+		req.Header.Set(cfg.API_SIGNATURE_HEADER, sign(cfg.API_HMAC_SECRET, jsonData))
+	}
+	if cfg.API_IDEMPOTENCY_HEADER != "" {
+		req.Header.Set(cfg.API_IDEMPOTENCY_HEADER, idempotencyKey(jsonData))
+	}
+	return do(client, req)
+}
+
+// newRequest creates the request of the payload with the headers every one has.
+func newRequest(apiURL, apiToken string, body io.Reader) (*http.Request, error) {
+	cfg := config.GetEnvConfig()
+	req, err := http.NewRequest(cfg.API_METHOD, apiURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", cfg.API_CONTENT_TYPE)
+	req.Header.Set(cfg.API_TOKEN_HEADER, apiToken)
+	req.Header.Set("User-Agent", cfg.UserAgent())
+	return req, nil
+}
+
+// do makes the request and reports whether a failure is worth retrying.
+func do(client *http.Client, req *http.Request) (bool, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return true, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+	}
+	return false, fmt.Errorf("API request failed with status: %d: %w", resp.StatusCode, ErrRejected)
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the body, so the API can
+// check the payload comes from a scraper knowing API_HMAC_SECRET.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// idempotencyKey returns the hex encoded SHA-256 of the body. The report is
+// sorted, so the same cluster state always yields the same key and the API
+// can drop a retry of a request it already got.
+func idempotencyKey(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// maxRetryDelay caps the doubling of the exponential strategy, which would
+// overflow a time.Duration after enough attempts.
+const maxRetryDelay = 5 * time.Minute
+
+// retryDelay returns the wait before the retry following the attempt:
+// the base interval with the fixed strategy, doubled per attempt with
+// exponential up to maxRetryDelay.
+func retryDelay(strategy string, baseMs int, attempt int) time.Duration {
+	base := time.Duration(baseMs) * time.Millisecond
+	if strategy == config.RetryStrategyFixed {
+		return base
+	}
+	if base > maxRetryDelay>>attempt {
+		return max(base, maxRetryDelay)
+	}
+	return base << attempt
+}
+
+// newClient returns the HTTP client for the ingestion API. It honors
+// HTTPS_PROXY/HTTP_PROXY/NO_PROXY, or API_PROXY when set, logging the proxy
+// API_URL goes through once, and skips verifying the API certificate with
+// API_INSECURE_SKIP_VERIFY.
+func newClient() (*http.Client, error) {
+	cfg := config.GetEnvConfig()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if cfg.API_INSECURE_SKIP_VERIFY {
+		log.Println("WARNING: API_INSECURE_SKIP_VERIFY is set, the API certificate is not verified; never use it in production")
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	if apiProxy := cfg.API_PROXY; apiProxy != "" {
+		proxyURL, err := url.Parse(apiProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_PROXY: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if apiURL, err := url.Parse(cfg.API_URL); err == nil {
+		if proxyURL, err := transport.Proxy(&http.Request{URL: apiURL}); err == nil && proxyURL != nil {
+			log.Printf("Sending data to API via proxy %s", proxyURL.Redacted())
+		}
+	}
+
+	return &http.Client{Timeout: 30 * time.Second, Transport: transport}, nil
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"keepup-helm-scraper/src/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testToken      = "test-token"
+	testHMACSecret = "test-secret"
+)
+
+func TestMain(m *testing.M) {
+	// APP_ENV skips the .env file, the configuration comes from here only
+	os.Setenv("APP_ENV", "test")
+	os.Setenv("API_URL", "http://api.invalid")
+	os.Setenv("API_TOKEN", testToken)
+	os.Setenv("CLUSTER_NAME", "test")
+	os.Setenv("API_HMAC_SECRET", testHMACSecret)
+	os.Setenv("API_TOKEN_HEADER", "X-Keepup-Token")
+	os.Setenv("API_IDEMPOTENCY_HEADER", "Idempotency-Key")
+	os.Exit(m.Run())
+}
+
+// failingServer responds with status to the first failures requests and
+// with 200 to the ones after, counting them in requests.
+func failingServer(t *testing.T, failures int32, status int, requests *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		strategy     string
+		failures     int32
+		status       int
+		wantErr      bool
+		wantRejected bool
+		wantRequests int32
+		wantDelays   []time.Duration
+	}{
+		{"fixed", config.RetryStrategyFixed, 2, http.StatusServiceUnavailable, false, false, 3,
+			[]time.Duration{10 * time.Millisecond, 10 * time.Millisecond}},
+		{"exponential", config.RetryStrategyExponential, 3, http.StatusTooManyRequests, false, false, 4,
+			[]time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}},
+		{"retries used up", config.RetryStrategyExponential, 5, http.StatusBadGateway, true, false, 4,
+			[]time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond}},
+		{"not retryable", config.RetryStrategyFixed, 1, http.StatusBadRequest, true, true, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := failingServer(t, tt.failures, tt.status, &requests)
+
+			var delays []time.Duration
+			sleep = func(d time.Duration) { delays = append(delays, d) }
+			t.Cleanup(func() { sleep = time.Sleep })
+
+			client, err := newClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := config.EnvConfig{API_RETRY_STRATEGY: tt.strategy, API_RETRY_BASE_MS: 10, API_MAX_RETRIES: 3}
+			err = retry(cfg, func() (bool, error) {
+				return send(client, srv.URL, testToken, []byte(`{}`))
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("retry() error = %v, want error %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrRejected) != tt.wantRejected {
+				t.Errorf("retry() error = %v, want ErrRejected %v", err, tt.wantRejected)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", got, tt.wantRequests)
+			}
+			if !slices.Equal(delays, tt.wantDelays) {
+				t.Errorf("retry() waited %v, want %v", delays, tt.wantDelays)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		strategy string
+		baseMs   int
+		attempt  int
+		want     time.Duration
+	}{
+		{config.RetryStrategyFixed, 500, 0, 500 * time.Millisecond},
+		{config.RetryStrategyFixed, 500, 100, 500 * time.Millisecond},
+		{config.RetryStrategyExponential, 500, 0, 500 * time.Millisecond},
+		{config.RetryStrategyExponential, 500, 3, 4 * time.Second},
+		{config.RetryStrategyExponential, 500, 10, maxRetryDelay},
+		// shifting this far overflows time.Duration
+		{config.RetryStrategyExponential, 500, 40, maxRetryDelay},
+		{config.RetryStrategyExponential, 500, 100, maxRetryDelay},
+		{config.RetryStrategyExponential, 600000, 0, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.strategy, tt.baseMs, tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%s, %d, %d) = %s, want %s", tt.strategy, tt.baseMs, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	payload := []byte(`{"cluster_name":"test","helm_charts":[]}`)
+	var verified bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, err := hex.DecodeString(r.Header.Get("X-Signature"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(testHMACSecret))
+		mac.Write(body)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		verified = true
+	}))
+	defer srv.Close()
+
+	client, err := newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := send(client, srv.URL, testToken, payload); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if !verified {
+		t.Error("server didn't verify the signature")
+	}
+}
+
+func TestSendTokenHeader(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	client, err := newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := send(client, srv.URL, testToken, []byte(`{}`)); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if got := header.Get("X-Keepup-Token"); got != testToken {
+		t.Errorf("API_TOKEN_HEADER X-Keepup-Token = %q, want %q", got, testToken)
+	}
+	if got := header.Get("x-api-token"); got != "" {
+		t.Errorf("default token header x-api-token = %q, want it unset", got)
+	}
+}
+
+func TestSendIdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+	}))
+	defer srv.Close()
+
+	client, err := newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := []string{
+		`{"cluster_name":"test","helm_charts":[{"chart_name":"nginx","version":"1.25.1"}]}`,
+		`{"cluster_name":"test","helm_charts":[{"chart_name":"nginx","version":"1.25.1"}]}`,
+		`{"cluster_name":"test","helm_charts":[{"chart_name":"nginx","version":"1.26.0"}]}`,
+	}
+	for _, payload := range payloads {
+		if _, err := send(client, srv.URL, testToken, []byte(payload)); err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(payloads[0]))
+	if want := hex.EncodeToString(sum[:]); keys[0] != want {
+		t.Errorf("idempotency key = %q, want the SHA-256 of the payload %q", keys[0], want)
+	}
+	if keys[1] != keys[0] {
+		t.Errorf("idempotency keys of the same payload differ: %q, %q", keys[0], keys[1])
+	}
+	if keys[2] == keys[0] {
+		t.Errorf("idempotency keys of different payloads are both %q", keys[0])
+	}
+}
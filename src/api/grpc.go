@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"keepup-helm-scraper/src/config"
+	"keepup-helm-scraper/src/inventorypb"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// SendGRPC sends the report, a marshaled inventorypb.ClusterInfo, to the
+// InventoryService at API_URL (host:port) over TLS. API_TOKEN and the
+// signature and idempotency key of SendData go in the request metadata,
+// under the same header names, and failed attempts are retried like there.
+func SendGRPC(data []byte) error {
+	cfg := config.GetEnvConfig()
+
+	if cfg.API_URL == "" || !hasToken() {
+		log.Println("API_URL or API_TOKEN not set, skipping API request")
+		return nil
+	}
+
+	var report inventorypb.ClusterInfo
+	if err := proto.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("invalid report: %w", err)
+	}
+
+	token, err := apiToken()
+	if err != nil {
+		return err
+	}
+
+	conn, err := newGRPCConn()
+	if err != nil {
+		return fmt.Errorf("failed to configure API client: %w", err)
+	}
+	defer conn.Close()
+
+	client := inventorypb.NewInventoryServiceClient(conn)
+	return retry(cfg, func() (bool, error) {
+		return sendGRPC(client, token, &report, data)
+	})
+}
+
+// sendGRPC makes a single call and reports whether a failure is worth retrying.
+func sendGRPC(client inventorypb.InventoryServiceClient, apiToken string, report *inventorypb.ClusterInfo, data []byte) (bool, error) {
+	cfg := config.GetEnvConfig()
+	md := metadata.Pairs(cfg.API_TOKEN_HEADER, apiToken)
+	if cfg.API_HMAC_SECRET != "" {
+		md.Append(cfg.API_SIGNATURE_HEADER, sign(cfg.API_HMAC_SECRET, data))
+	}
+	if cfg.API_IDEMPOTENCY_HEADER != "" {
+		md.Append(cfg.API_IDEMPOTENCY_HEADER, idempotencyKey(data))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := client.SendClusterInfo(metadata.NewOutgoingContext(ctx, md), report)
+	if err == nil {
+		return false, nil
+	}
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true, err
+	default:
+		return false, fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+}
+
+// probeGRPC checks that a connection to API_URL can be established.
+func probeGRPC() error {
+	conn, err := newGRPCConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("API not reachable, connection %s", state)
+		}
+	}
+	return nil
+}
+
+// newGRPCConn returns the connection to the ingestion API, skipping
+// verifying its certificate with API_INSECURE_SKIP_VERIFY.
+func newGRPCConn() (*grpc.ClientConn, error) {
+	cfg := config.GetEnvConfig()
+	tlsConfig := &tls.Config{}
+	if cfg.API_INSECURE_SKIP_VERIFY {
+		log.Println("WARNING: API_INSECURE_SKIP_VERIFY is set, the API certificate is not verified; never use it in production")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return grpc.NewClient(cfg.API_URL,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithUserAgent(cfg.UserAgent()),
+	)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"keepup-helm-scraper/src/config"
+	"keepup-helm-scraper/src/vault"
+	"sync"
+	"time"
+)
+
+// vaultToken is API_TOKEN as read from Vault, shared by the sends of a
+// process so it's cached across the scrapes of interval mode.
+var vaultToken = sync.OnceValue(func() *vault.Secret {
+	cfg := config.GetEnvConfig()
+	return vault.NewSecret(vault.Options{
+		Addr:      cfg.VAULT_ADDR,
+		Token:     cfg.VAULT_TOKEN,
+		Role:      cfg.VAULT_ROLE,
+		AuthMount: cfg.VAULT_AUTH_MOUNT,
+		Path:      cfg.VAULT_SECRET_PATH,
+		Key:       cfg.VAULT_SECRET_KEY,
+		TTL:       time.Duration(cfg.VAULT_CACHE_SECONDS) * time.Second,
+	})
+})
+
+// hasToken reports whether there's an API_TOKEN to send, set or in Vault.
+func hasToken() bool {
+	cfg := config.GetEnvConfig()
+	return cfg.API_TOKEN != "" || cfg.VAULT_ADDR != ""
+}
+
+// apiToken returns API_TOKEN, read from Vault when VAULT_ADDR is set.
+func apiToken() (string, error) {
+	cfg := config.GetEnvConfig()
+	if cfg.VAULT_ADDR == "" {
+		return cfg.API_TOKEN, nil
+	}
+	token, err := vaultToken().Value()
+	if err != nil {
+		return "", fmt.Errorf("failed to read API_TOKEN from Vault: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,58 @@
+package clusters
+
+import (
+	"fmt"
+	"os"
+
+	"go.yaml.in/yaml/v2"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Cluster is a cluster to scrape and the name it is reported under.
+// Without a kubeconfig the cluster the scraper runs in is used.
+type Cluster struct {
+	Name       string `yaml:"name"`
+	Kubeconfig string `yaml:"kubeconfig"`
+	Context    string `yaml:"context"`
+}
+
+type ClustersFile struct {
+	Clusters []Cluster `yaml:"clusters"`
+}
+
+func Load(path string) ([]Cluster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cf ClustersFile
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range cf.Clusters {
+		if c.Name == "" {
+			return nil, fmt.Errorf("cluster #%d has no name", i+1)
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("duplicate cluster name %s", c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return cf.Clusters, nil
+}
+
+// RESTConfig returns the client config of the cluster's kubeconfig and context.
+func (c Cluster) RESTConfig() (*rest.Config, error) {
+	if c.Kubeconfig == "" {
+		return rest.InClusterConfig()
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: c.Kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: c.Context},
+	).ClientConfig()
+}
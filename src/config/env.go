@@ -2,26 +2,209 @@ package config
 
 import (
 	"log"
+	"net/http"
 	"os"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
+const (
+	ScanModeImages = "images"
+	ScanModeHelm   = "helm"
+	ScanModeBoth   = "both"
+
+	RetryStrategyExponential = "exponential"
+	RetryStrategyFixed       = "fixed"
+
+	ModeOneshot  = "oneshot"
+	ModeInterval = "interval"
+
+	OutputFormatJSON   = "json"
+	OutputFormatNDJSON = "ndjson"
+
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// EnvConfig fields are read from the environment variables of the same name.
+// A field with a `default` tag is optional, all others are mandatory.
+// Fields are strings, bools, numbers or comma-separated string lists.
 type EnvConfig struct {
-	APP_ENV      string
-	API_URL      string
-	API_TOKEN    string
-	CLUSTER_NAME string
-	RULES_FILE   string
+	APP_ENV                   string
+	API_URL                   string
+	CLUSTER_NAME              string
+	API_TOKEN                 string   `default:""`
+	RULES_FILE                string   `default:"./keepup-detection.yaml"`
+	RULES_OVERLAY_FILE        string   `default:""`
+	SCAN_MODE                 string   `default:"images"`
+	SCAN_CRDS                 string   `default:""`
+	REPORT_NAMESPACES         bool     `default:"false"`
+	TARGET_NAMESPACE          string   `default:""`
+	COLLECT_RESOURCES         bool     `default:"false"`
+	HELM_LABEL_SELECTOR       string   `default:"owner=helm"`
+	API_PROXY                 string   `default:""`
+	SIDECAR_CONTAINERS        []string `default:""`
+	API_MAX_RETRIES           int      `default:"3"`
+	API_RETRY_STRATEGY        string   `default:"exponential"`
+	API_RETRY_BASE_MS         int      `default:"500"`
+	SERVE_ADDR                string   `default:""`
+	SCAN_ROLLOUTS             bool     `default:"false"`
+	CLUSTER_NAME_CONFIGMAP    string   `default:""`
+	FAIL_ON_EMPTY             bool     `default:"false"`
+	CLUSTERS_CONFIG           string   `default:""`
+	KUBE_QPS                  float64  `default:"5"`
+	KUBE_BURST                int      `default:"10"`
+	PAYLOAD_TEMPLATE          string   `default:""`
+	HELM_MAX_AGE_DAYS         int      `default:"0"`
+	CONTAINER_NAME_FILTER     string   `default:""`
+	API_HMAC_SECRET           string   `default:""`
+	API_SIGNATURE_HEADER      string   `default:"X-Signature"`
+	USER_AGENT                string   `default:""`
+	EXCLUDE_APPLICATIONS      []string `default:""`
+	EXCLUDE_IMAGES            []string `default:""`
+	RULES_AUTH_HEADER         string   `default:""`
+	REPORT_VERSION_SKEW       bool     `default:"false"`
+	API_METHOD                string   `default:"PUT"`
+	API_CONTENT_TYPE          string   `default:"application/json"`
+	COLLECT_IMAGE_IDS         bool     `default:"false"`
+	REPORT_UNMATCHED_RULES    bool     `default:"false"`
+	SPOOL_DIR                 string   `default:""`
+	SPOOL_MAX_MB              int      `default:"50"`
+	COLLECT_NODES             bool     `default:"false"`
+	API_TOKEN_HEADER          string   `default:"x-api-token"`
+	OUTPUT_FORMAT             string   `default:"json"`
+	OUTPUT_FILE               string   `default:""`
+	API_INSECURE_SKIP_VERIFY  bool     `default:"false"`
+	SCAN_DEPLOYMENTCONFIGS    bool     `default:"false"`
+	REPORT_LABELS             []string `default:""`
+	MODE                      string   `default:"oneshot"`
+	SCRAPE_INTERVAL_SECONDS   int      `default:"3600"`
+	EXPOSE_INVENTORY_METRICS  bool     `default:"false"`
+	KUBE_MAX_RETRIES          int      `default:"3"`
+	KUBE_VERSION_FORMAT       string   `default:"raw"`
+	JOB_LOOKBACK_HOURS        int      `default:"0"`
+	API_IDEMPOTENCY_HEADER    string   `default:""`
+	RESOLVE_IMAGE_LABELS      bool     `default:"false"`
+	API_TRANSPORT             string   `default:"http"`
+	SCAN_KINDS                []string `default:"deployments,statefulsets,daemonsets"`
+	CLUSTER_NAME_NODE_LABEL   string   `default:""`
+	REDACT_REGISTRIES         []string `default:""`
+	API_STREAM                bool     `default:"false"`
+	INCREMENTAL_SCAN          bool     `default:"false"`
+	VERSION_RESOLVER_CMD      string   `default:""`
+	LOG_PAYLOAD               bool     `default:"false"`
+	OUTPUT_S3                 string   `default:""`
+	OUTPUT_S3_KEY             string   `default:"{{.ClusterName}}/{{.Timestamp}}.json"`
+	OUTPUT_S3_ENDPOINT        string   `default:""`
+	DETECT_MESH               bool     `default:"false"`
+	PAYLOAD_FIELD_MAP         []string `default:""`
+	REPORT_UNMATCHED_IMAGES   bool     `default:"false"`
+	VAULT_ADDR                string   `default:""`
+	VAULT_TOKEN               string   `default:""`
+	VAULT_ROLE                string   `default:""`
+	VAULT_AUTH_MOUNT          string   `default:"kubernetes"`
+	VAULT_SECRET_PATH         string   `default:""`
+	VAULT_SECRET_KEY          string   `default:"token"`
+	VAULT_CACHE_SECONDS       int      `default:"300"`
+	STATUS_CONFIGMAP          string   `default:""`
+	OUTPUT_APPLICATION_FILTER string   `default:""`
+	METADATA_CACHE_TTL        string   `default:"1h"`
+	MAX_NAMESPACES            int      `default:"0"`
+	MAX_WORKLOADS             int      `default:"0"`
+	OUTPUT_INDENT             string   `default:""`
+	COLLECT_ANNOTATIONS       []string `default:""`
+	REPORT_DOWNGRADES         bool     `default:"false"`
+	REPORT_TOP_N              int      `default:"0"`
+	PARSE_HELM_MANIFEST       bool     `default:"false"`
+	HELM_RELEASE_LABELS       []string `default:"meta.helm.sh/release-name,app.kubernetes.io/instance"`
+	SHUTDOWN_TIMEOUT_SECONDS  int      `default:"20"`
 }
 
-var config *EnvConfig
+// Version of the scraper, set at build time with
+// -ldflags "-X keepup-helm-scraper/src/config.Version=..."
+var Version = "dev"
 
+var (
+	config     *EnvConfig
+	loadConfig sync.Once
+)
+
+// GetEnvConfig returns the configuration, read from the environment on the
+// first call, so commands not calling it, like lint, run without one.
 func GetEnvConfig() EnvConfig {
+	loadConfig.Do(load)
 	return *config
 }
 
+// ScanImages reports whether workload images are scanned with the detection rules.
+func (c EnvConfig) ScanImages() bool {
+	return c.SCAN_MODE == ScanModeImages || c.SCAN_MODE == ScanModeBoth
+}
+
+// ScanHelm reports whether Helm release secrets are scanned.
+func (c EnvConfig) ScanHelm() bool {
+	return c.SCAN_MODE == ScanModeHelm || c.SCAN_MODE == ScanModeBoth
+}
+
+// UserAgent identifies the scraper to the apiserver and the ingestion API,
+// USER_AGENT overrides the default keepup-helm-scraper/<version>.
+func (c EnvConfig) UserAgent() string {
+	if c.USER_AGENT != "" {
+		return c.USER_AGENT
+	}
+	return "keepup-helm-scraper/" + Version
+}
+
+// ReportLabels returns the k=v pairs of REPORT_LABELS as a map.
+func (c EnvConfig) ReportLabels() map[string]string {
+	if len(c.REPORT_LABELS) == 0 {
+		return nil
+	}
+	reportLabels := make(map[string]string)
+	for _, pair := range c.REPORT_LABELS {
+		k, v, _ := strings.Cut(pair, "=")
+		reportLabels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return reportLabels
+}
+
+// PayloadFieldMap returns the from=to renames of PAYLOAD_FIELD_MAP as a map.
+func (c EnvConfig) PayloadFieldMap() map[string]string {
+	if len(c.PAYLOAD_FIELD_MAP) == 0 {
+		return nil
+	}
+	fieldMap := make(map[string]string)
+	for _, pair := range c.PAYLOAD_FIELD_MAP {
+		from, to, _ := strings.Cut(pair, "=")
+		fieldMap[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	return fieldMap
+}
+
+// MetadataCacheTTL returns METADATA_CACHE_TTL as a duration.
+func (c EnvConfig) MetadataCacheTTL() time.Duration {
+	ttl, _ := time.ParseDuration(c.METADATA_CACHE_TTL)
+	return ttl
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func loadEnvFile() {
 	log.Println("Loading .env file.")
 	err := godotenv.Load(".env")
@@ -30,24 +213,200 @@ func loadEnvFile() {
 	}
 }
 
-func init() {
+// load reads and validates the configuration, exiting on invalid values.
+func load() {
 	config = &EnvConfig{}
 	_, found := os.LookupEnv("APP_ENV")
 	if !found {
 		loadEnvFile()
 	}
-	_, found = os.LookupEnv("RULES_FILE")
-	if !found {
-		os.Setenv("RULES_FILE", "./keepup-detection.yaml")
-	}
 	refl := reflect.ValueOf(config).Elem()
 	numFields := refl.NumField()
 	for i := 0; i < numFields; i++ {
-		envName := refl.Type().Field(i).Name
+		field := refl.Type().Field(i)
+		envName := field.Name
 		envVal, foud := os.LookupEnv(envName)
+		if !foud {
+			envVal, foud = field.Tag.Lookup("default")
+		}
 		if !foud {
 			log.Fatalf("Environment not found: %v", envName)
 		}
-		refl.Field(i).SetString(envVal)
+		switch field.Type.Kind() {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(envVal)
+			if err != nil {
+				log.Fatalf("Environment %v must be a boolean: %v", envName, envVal)
+			}
+			refl.Field(i).SetBool(b)
+		case reflect.Int:
+			n, err := strconv.Atoi(envVal)
+			if err != nil {
+				log.Fatalf("Environment %v must be an integer: %v", envName, envVal)
+			}
+			refl.Field(i).SetInt(int64(n))
+		case reflect.Float64:
+			f, err := strconv.ParseFloat(envVal, 64)
+			if err != nil {
+				log.Fatalf("Environment %v must be a number: %v", envName, envVal)
+			}
+			refl.Field(i).SetFloat(f)
+		case reflect.Slice:
+			refl.Field(i).Set(reflect.ValueOf(splitList(envVal)))
+		default:
+			refl.Field(i).SetString(envVal)
+		}
+	}
+
+	switch config.SCAN_MODE {
+	case ScanModeImages, ScanModeHelm, ScanModeBoth:
+	default:
+		log.Fatalf("Unsupported SCAN_MODE: %v", config.SCAN_MODE)
+	}
+
+	switch config.API_RETRY_STRATEGY {
+	case RetryStrategyExponential, RetryStrategyFixed:
+	default:
+		log.Fatalf("Unsupported API_RETRY_STRATEGY: %v", config.API_RETRY_STRATEGY)
+	}
+
+	switch config.API_METHOD {
+	case http.MethodPut, http.MethodPost, http.MethodPatch:
+	default:
+		log.Fatalf("Unsupported API_METHOD: %v", config.API_METHOD)
+	}
+
+	switch config.MODE {
+	case ModeOneshot, ModeInterval:
+	default:
+		log.Fatalf("Unsupported MODE: %v", config.MODE)
+	}
+
+	if config.MODE == ModeInterval && config.SCRAPE_INTERVAL_SECONDS <= 0 {
+		log.Fatalf("SCRAPE_INTERVAL_SECONDS must be positive, got %d", config.SCRAPE_INTERVAL_SECONDS)
+	}
+	if config.MODE == ModeInterval && config.SHUTDOWN_TIMEOUT_SECONDS <= 0 {
+		log.Fatalf("SHUTDOWN_TIMEOUT_SECONDS must be positive, got %d", config.SHUTDOWN_TIMEOUT_SECONDS)
+	}
+	if config.INCREMENTAL_SCAN && (config.MODE != ModeInterval || config.SERVE_ADDR != "") {
+		log.Fatalf("INCREMENTAL_SCAN needs MODE=interval without SERVE_ADDR")
+	}
+	// a one-shot run has no previous scrape to compare with unless its
+	// versions are kept in STATUS_CONFIGMAP
+	if config.REPORT_DOWNGRADES && config.MODE != ModeInterval && config.SERVE_ADDR == "" && config.STATUS_CONFIGMAP == "" {
+		log.Fatalf("REPORT_DOWNGRADES needs MODE=interval, SERVE_ADDR or STATUS_CONFIGMAP")
+	}
+
+	// the formats of scraper.Options.KubeVersionFormat
+	switch config.KUBE_VERSION_FORMAT {
+	case "raw", "semver", "major-minor":
+	default:
+		log.Fatalf("Unsupported KUBE_VERSION_FORMAT: %v", config.KUBE_VERSION_FORMAT)
+	}
+
+	// the kinds of scraper.Options.Kinds
+	for _, kind := range config.SCAN_KINDS {
+		switch kind {
+		case "deployments", "statefulsets", "daemonsets":
+		default:
+			log.Fatalf("Unsupported SCAN_KINDS kind: %v", kind)
+		}
+	}
+
+	switch config.API_TRANSPORT {
+	case TransportHTTP, TransportGRPC:
+	default:
+		log.Fatalf("Unsupported API_TRANSPORT: %v", config.API_TRANSPORT)
+	}
+
+	switch config.OUTPUT_FORMAT {
+	case OutputFormatJSON, OutputFormatNDJSON:
+	default:
+		log.Fatalf("Unsupported OUTPUT_FORMAT: %v", config.OUTPUT_FORMAT)
+	}
+
+	if _, err := labels.Parse(config.HELM_LABEL_SELECTOR); err != nil {
+		log.Fatalf("Invalid HELM_LABEL_SELECTOR: %v", err)
+	}
+
+	for _, key := range config.HELM_RELEASE_LABELS {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			log.Fatalf("Invalid HELM_RELEASE_LABELS key %s: %s", key, strings.Join(errs, ", "))
+		}
+	}
+
+	if config.CLUSTER_NAME_NODE_LABEL != "" {
+		if errs := validation.IsQualifiedName(config.CLUSTER_NAME_NODE_LABEL); len(errs) > 0 {
+			log.Fatalf("Invalid CLUSTER_NAME_NODE_LABEL: %s", strings.Join(errs, ", "))
+		}
+	}
+
+	// API_TOKEN is set or read from Vault, and needed once there's an API_URL
+	fromVault := config.VAULT_ADDR != "" || config.VAULT_SECRET_PATH != ""
+	switch {
+	case config.API_TOKEN != "" && fromVault:
+		log.Fatalf("Set either API_TOKEN or VAULT_ADDR, not both")
+	case config.API_TOKEN == "" && !fromVault && config.API_URL != "":
+		log.Fatalf("API_URL needs API_TOKEN or VAULT_ADDR to read it from")
+	}
+
+	if fromVault {
+		if config.VAULT_ADDR == "" {
+			log.Fatalf("VAULT_SECRET_PATH needs VAULT_ADDR")
+		}
+		if config.VAULT_SECRET_PATH == "" {
+			log.Fatalf("VAULT_ADDR needs VAULT_SECRET_PATH")
+		}
+		if config.VAULT_TOKEN == "" && config.VAULT_ROLE == "" {
+			log.Fatalf("VAULT_ADDR needs VAULT_TOKEN or VAULT_ROLE to log in")
+		}
+		if config.VAULT_CACHE_SECONDS <= 0 {
+			log.Fatalf("VAULT_CACHE_SECONDS must be positive, got %d", config.VAULT_CACHE_SECONDS)
+		}
+	}
+
+	if strings.Trim(config.OUTPUT_INDENT, " \t") != "" {
+		log.Fatalf("OUTPUT_INDENT must be spaces or tabs, got %q", config.OUTPUT_INDENT)
+	}
+
+	if config.MAX_NAMESPACES < 0 || config.MAX_WORKLOADS < 0 {
+		log.Fatalf("MAX_NAMESPACES and MAX_WORKLOADS must be 0 or more")
+	}
+	if config.PARSE_HELM_MANIFEST && !config.ScanHelm() {
+		log.Fatalf("PARSE_HELM_MANIFEST needs SCAN_MODE=helm or both")
+	}
+	if config.REPORT_TOP_N < 0 {
+		log.Fatalf("REPORT_TOP_N must be 0 or more, got %d", config.REPORT_TOP_N)
+	}
+
+	if ttl, err := time.ParseDuration(config.METADATA_CACHE_TTL); err != nil || ttl < 0 {
+		log.Fatalf("METADATA_CACHE_TTL must be a duration like 1h or 30m, 0 to not cache, got %q", config.METADATA_CACHE_TTL)
+	}
+
+	if ref := strings.Split(config.STATUS_CONFIGMAP, "/"); config.STATUS_CONFIGMAP != "" && (len(ref) != 2 || ref[0] == "" || ref[1] == "") {
+		log.Fatalf("STATUS_CONFIGMAP must be namespace/name, got %q", config.STATUS_CONFIGMAP)
+	}
+
+	if config.RULES_AUTH_HEADER != "" && !strings.Contains(config.RULES_AUTH_HEADER, ":") {
+		log.Fatalf("RULES_AUTH_HEADER must be a header like 'Authorization: Bearer <token>'")
+	}
+
+	for _, pair := range config.REPORT_LABELS {
+		if k, _, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(k) == "" {
+			log.Fatalf("REPORT_LABELS must be comma-separated k=v pairs, got %q", pair)
+		}
+	}
+
+	for _, pair := range config.PAYLOAD_FIELD_MAP {
+		if from, to, ok := strings.Cut(pair, "="); !ok || strings.TrimSpace(from) == "" || strings.TrimSpace(to) == "" {
+			log.Fatalf("PAYLOAD_FIELD_MAP must be comma-separated from=to pairs, got %q", pair)
+		}
+	}
+	if len(config.PAYLOAD_FIELD_MAP) > 0 && config.PAYLOAD_TEMPLATE != "" {
+		log.Fatalf("PAYLOAD_FIELD_MAP and PAYLOAD_TEMPLATE can't be combined, rename the fields in the template")
+	}
+
+	if _, err := regexp.Compile(config.CONTAINER_NAME_FILTER); err != nil {
+		log.Fatalf("Invalid CONTAINER_NAME_FILTER: %v", err)
 	}
 }
@@ -0,0 +1,236 @@
+package crd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Resource is a custom workload kind and the paths to its pod spec and replica
+// counts. A single replica is assumed when the replicas aren't found, and all
+// replicas are counted as ready when the ready replicas aren't found.
+type Resource struct {
+	GVR               schema.GroupVersionResource
+	PodSpecPath       []string
+	ReplicasPath      []string
+	ReadyReplicasPath []string
+	// podSpecs is the JSONPath template to the pod specs of a resource with
+	// several, f/e in a list, which ParseResources sets instead of PodSpecPath
+	podSpecs string
+	// whether podSpecs points to the pod templates holding the specs
+	podSpecsInTemplates bool
+}
+
+// the conventional replica paths of resources with a scale subresource
+var (
+	defaultReplicasPath      = []string{"spec", "replicas"}
+	defaultReadyReplicasPath = []string{"status", "readyReplicas"}
+)
+
+// Rollouts are Argo Rollouts, which replace Deployments for canary releases.
+var Rollouts = Resource{
+	GVR:               schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"},
+	PodSpecPath:       []string{"spec", "template", "spec"},
+	ReplicasPath:      defaultReplicasPath,
+	ReadyReplicasPath: defaultReadyReplicasPath,
+}
+
+// DeploymentConfigs are OpenShift DeploymentConfigs, which legacy apps on
+// OpenShift use instead of Deployments.
+var DeploymentConfigs = Resource{
+	GVR:               schema.GroupVersionResource{Group: "apps.openshift.io", Version: "v1", Resource: "deploymentconfigs"},
+	PodSpecPath:       []string{"spec", "template", "spec"},
+	ReplicasPath:      defaultReplicasPath,
+	ReadyReplicasPath: defaultReadyReplicasPath,
+}
+
+// PodTemplate is the pod spec of a single custom resource.
+type PodTemplate struct {
+	Name string
+	// Annotations of the pod template, the others of the resource itself
+	Annotations         map[string]string
+	ResourceLabels      map[string]string
+	ResourceAnnotations map[string]string
+	Spec                corev1.PodSpec
+	Replicas            int64
+	ReadyReplicas       int64
+}
+
+// ParseResources parses a comma-separated list of
+// <group>/<version>/<resource>=<path> entries, where path is a JSONPath to
+// the pod spec, f/e postgresql.cnpg.io/v1/clusters=.spec.template.spec, or to
+// several, f/e elasticsearch.k8s.elastic.co/v1/elasticsearches=.spec.nodeSets[*].podTemplate.spec.
+// Paths can't contain commas.
+func ParseResources(spec string) ([]Resource, error) {
+	var resources []Resource
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		gvrStr, pathStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing pod spec path in %q", entry)
+		}
+
+		parts := strings.Split(gvrStr, "/")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("expected <group>/<version>/<resource> in %q", entry)
+		}
+
+		path := strings.Trim(pathStr, "{}")
+		path = strings.TrimPrefix(path, ".")
+		if path == "" {
+			return nil, fmt.Errorf("empty pod spec path in %q", entry)
+		}
+
+		res := Resource{
+			GVR:               schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]},
+			ReplicasPath:      defaultReplicasPath,
+			ReadyReplicasPath: defaultReadyReplicasPath,
+		}
+		if fieldPath.MatchString(path) {
+			res.PodSpecPath = strings.Split(path, ".")
+		} else {
+			// a path to pod specs is evaluated up to their templates,
+			// to read the annotations next to them
+			templatePath, inTemplates := strings.CutSuffix(path, ".spec")
+			if !inTemplates {
+				templatePath = path
+			}
+			res.podSpecs, res.podSpecsInTemplates = "{."+templatePath+"}", inTemplates
+			if _, err := res.podSpecsPath(); err != nil {
+				return nil, fmt.Errorf("invalid pod spec path in %q: %w", entry, err)
+			}
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// fieldPath matches the dotted paths of plain fields.
+var fieldPath = regexp.MustCompile(`^[\w-]+(\.[\w-]+)*$`)
+
+// podSpecsPath parses the JSONPath to the pod specs, anew for every use as
+// a JSONPath keeps the state of its last evaluation.
+func (r Resource) podSpecsPath() (*jsonpath.JSONPath, error) {
+	jp := jsonpath.New(r.GVR.Resource).AllowMissingKeys(true)
+	if err := jp.Parse(r.podSpecs); err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+// CollectPodTemplates lists the resource in the namespace and returns the pod
+// specs found at its path. A resource not served by the cluster yields nothing.
+func CollectPodTemplates(
+	ctx context.Context,
+	client dynamic.Interface,
+	ns string,
+	res Resource,
+) ([]PodTemplate, error) {
+	list, err := client.Resource(res.GVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jp *jsonpath.JSONPath
+	if res.podSpecs != "" {
+		if jp, err = res.podSpecsPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	var templates []PodTemplate
+	for _, item := range list.Items {
+		replicas := nestedInt64(item.Object, res.ReplicasPath, 1)
+		for _, found := range podSpecs(item.Object, res, jp) {
+			var spec corev1.PodSpec
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(found.spec, &spec); err != nil {
+				return nil, fmt.Errorf("%s %s/%s: %w", res.GVR.Resource, ns, item.GetName(), err)
+			}
+			templates = append(templates, PodTemplate{
+				Name:                item.GetName(),
+				Annotations:         found.annotations,
+				ResourceLabels:      item.GetLabels(),
+				ResourceAnnotations: item.GetAnnotations(),
+				Spec:                spec,
+				Replicas:            replicas,
+				ReadyReplicas:       nestedInt64(item.Object, res.ReadyReplicasPath, replicas),
+			})
+		}
+	}
+	return templates, nil
+}
+
+// foundPodSpec is a pod spec of a resource with the annotations of its template.
+type foundPodSpec struct {
+	spec        map[string]interface{}
+	annotations map[string]string
+}
+
+// podSpecs returns the pod specs at the path of the resource in the object,
+// jp being its parsed JSONPath if it has one.
+func podSpecs(obj map[string]interface{}, res Resource, jp *jsonpath.JSONPath) []foundPodSpec {
+	if jp == nil {
+		raw, found, err := unstructured.NestedMap(obj, res.PodSpecPath...)
+		if err != nil || !found {
+			return nil
+		}
+		// pod template metadata sits next to its spec
+		metadataPath := append(slices.Clone(res.PodSpecPath[:len(res.PodSpecPath)-1]), "metadata", "annotations")
+		annotations, _, _ := unstructured.NestedStringMap(obj, metadataPath...)
+		return []foundPodSpec{{spec: raw, annotations: annotations}}
+	}
+
+	results, err := jp.FindResults(obj)
+	if err != nil {
+		return nil
+	}
+	var specs []foundPodSpec
+	for _, values := range results {
+		for _, v := range values {
+			raw, ok := v.Interface().(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if !res.podSpecsInTemplates {
+				specs = append(specs, foundPodSpec{spec: raw})
+				continue
+			}
+			spec, found, err := unstructured.NestedMap(raw, "spec")
+			if err != nil || !found {
+				continue
+			}
+			annotations, _, _ := unstructured.NestedStringMap(raw, "metadata", "annotations")
+			specs = append(specs, foundPodSpec{spec: spec, annotations: annotations})
+		}
+	}
+	return specs
+}
+
+func nestedInt64(obj map[string]interface{}, path []string, def int64) int64 {
+	if len(path) == 0 {
+		return def
+	}
+	n, found, err := unstructured.NestedInt64(obj, path...)
+	if err != nil || !found {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,102 @@
+package helm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// PodTemplate is a pod spec of a resource in the manifest of a release.
+type PodTemplate struct {
+	// Kind, Name and Namespace of the resource; the namespace is empty
+	// when the manifest leaves it to the release
+	Kind      string
+	Name      string
+	Namespace string
+	// Annotations of the pod template
+	Annotations map[string]string
+	Spec        corev1.PodSpec
+}
+
+// PodTemplates returns the pod specs of the resources in the rendered
+// manifest of the release, found at any depth, so the ones of CronJobs or
+// custom resources are returned as well as those of Deployments. The
+// manifest is only kept with Options.KeepManifests. A document that isn't
+// valid YAML fails it.
+func (r Release) PodTemplates() ([]PodTemplate, error) {
+	reader := yaml.NewYAMLReader(bufio.NewReader(strings.NewReader(r.Manifest)))
+	var templates []PodTemplate
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return templates, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return nil, err
+		}
+		// documents of templates rendering nothing but their # Source comment
+		if obj == nil {
+			continue
+		}
+
+		kind, _, _ := unstructured.NestedString(obj, "kind")
+		name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+		namespace, _, _ := unstructured.NestedString(obj, "metadata", "namespace")
+		for _, found := range podSpecs(obj, nil) {
+			var spec corev1.PodSpec
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(found.spec, &spec); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", kind, name, err)
+			}
+			templates = append(templates, PodTemplate{
+				Kind:        kind,
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: found.annotations,
+				Spec:        spec,
+			})
+		}
+	}
+}
+
+type foundPodSpec struct {
+	spec        map[string]interface{}
+	annotations map[string]string
+}
+
+// podSpecs returns the objects under node with a list of containers, with
+// the annotations of the objects holding them as their spec, f/e of the
+// pod template of a Deployment.
+func podSpecs(node interface{}, annotations map[string]string) []foundPodSpec {
+	var found []foundPodSpec
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if _, ok := n["containers"].([]interface{}); ok {
+			return append(found, foundPodSpec{spec: n, annotations: annotations})
+		}
+		for _, key := range slices.Sorted(maps.Keys(n)) {
+			var specAnnotations map[string]string
+			if key == "spec" {
+				specAnnotations, _, _ = unstructured.NestedStringMap(n, "metadata", "annotations")
+			}
+			found = append(found, podSpecs(n[key], specAnnotations)...)
+		}
+	case []interface{}:
+		for _, item := range n {
+			found = append(found, podSpecs(item, nil)...)
+		}
+	}
+	return found
+}
@@ -0,0 +1,241 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	statusDeployed = "deployed"
+	// the documented encoding of the release payload
+	standardDecodePath = "base64+gzip"
+	// enough for double base64 around gzip, bounds malformed input
+	maxDecodeLayers = 4
+	// prefix of the names of Helm 3 release secrets, sh.helm.release.v1.<name>.v<revision>
+	secretNamePrefix = "sh.helm.release.v1."
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Release is the part of a Helm 3 release record the scraper reports.
+type Release struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	// Manifest holds the rendered resources of the release as YAML
+	// documents, see PodTemplates
+	Manifest string `json:"manifest"`
+	Info     struct {
+		Status       string    `json:"status"`
+		LastDeployed time.Time `json:"last_deployed"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+}
+
+// Options select the release secrets to read.
+type Options struct {
+	// Namespace to read, all namespaces when empty
+	Namespace     string
+	LabelSelector string
+	// MaxAge skips releases deployed longer ago, unlimited when zero
+	MaxAge time.Duration
+	// KeepManifests keeps the manifests of the releases, by far the bulk of
+	// them, which are dropped after decoding otherwise
+	KeepManifests bool
+}
+
+// DecodeError is a release secret that couldn't be decoded.
+type DecodeError struct {
+	Namespace string
+	Name      string
+	Err       error
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode Helm release %s/%s: %v", e.Namespace, e.Name, e.Err)
+}
+
+// CollectReleases reads Helm release secrets as selected by the options
+// and returns the currently deployed releases, only the latest revision of
+// a release deployed more than once. Secrets failing to decode or panicking
+// are skipped and returned as DecodeErrors.
+func CollectReleases(ctx context.Context, client kubernetes.Interface, opts Options) ([]Release, []DecodeError, error) {
+	secrets, err := client.CoreV1().Secrets(opts.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: opts.LabelSelector,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// decoding is CPU-bound gzip and JSON work, spread over the CPUs and kept
+	// in secrets order so the result doesn't depend on the scheduling
+	type decoded struct {
+		rel  Release
+		path string
+		err  error
+	}
+	results := make([]decoded, len(secrets.Items))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, s := range secrets.Items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rel, decodePath, err := decodeRecovered(s.Data["release"])
+			if !opts.KeepManifests {
+				rel.Manifest = ""
+			}
+			results[i] = decoded{rel, decodePath, err}
+		}()
+	}
+	wg.Wait()
+
+	var releases []Release
+	var decodeErrors []DecodeError
+	// index in releases and revision of the release by namespace/name, as a
+	// failed upgrade can leave an older revision marked deployed
+	latest := make(map[string]struct{ index, revision int })
+	for i, s := range secrets.Items {
+		rel, decodePath, err := results[i].rel, results[i].path, results[i].err
+		if err != nil {
+			decodeErr := DecodeError{Namespace: s.Namespace, Name: s.Name, Err: err}
+			log.Println(decodeErr)
+			decodeErrors = append(decodeErrors, decodeErr)
+			continue
+		}
+		if decodePath != standardDecodePath {
+			log.Printf("Decoded Helm release %s/%s via %s", s.Namespace, s.Name, decodePath)
+		}
+		if rel.Info.Status != statusDeployed {
+			continue
+		}
+
+		if opts.MaxAge > 0 {
+			deployed := rel.Info.LastDeployed
+			if deployed.IsZero() {
+				deployed = s.CreationTimestamp.Time
+			}
+			if time.Since(deployed) > opts.MaxAge {
+				continue
+			}
+		}
+
+		name, revision, ok := parseHelmSecretName(s.Name)
+		if !ok {
+			name, revision = rel.Name, rel.Version
+		}
+		key := s.Namespace + "/" + name
+		if prev, found := latest[key]; found {
+			if revision > prev.revision {
+				releases[prev.index] = rel
+				latest[key] = struct{ index, revision int }{prev.index, revision}
+			}
+			continue
+		}
+		latest[key] = struct{ index, revision int }{len(releases), revision}
+		releases = append(releases, rel)
+	}
+
+	return releases, decodeErrors, nil
+}
+
+// decodeRecovered is decodeRelease returning a panic on malformed
+// input as an error, so one secret doesn't lose the other releases.
+func decodeRecovered(data []byte) (rel Release, path string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return decodeRelease(data)
+}
+
+// decodeRelease decodes the release payload Helm stores as base64 of gzipped JSON.
+// Depending on the storage path the payload may already be decoded or be
+// base64-encoded once more, so layers are peeled off while they are present.
+// It returns the decoding path that worked, f/e "base64+gzip".
+func decodeRelease(data []byte) (Release, string, error) {
+	var rel Release
+	var path []string
+
+	for range maxDecodeLayers {
+		trimmed := bytes.TrimSpace(data)
+		switch {
+		case bytes.HasPrefix(trimmed, []byte("{")):
+			if err := json.Unmarshal(trimmed, &rel); err != nil {
+				return rel, "", fmt.Errorf("json: %w", err)
+			}
+			if len(path) == 0 {
+				return rel, "plain JSON", nil
+			}
+			return rel, strings.Join(path, "+"), nil
+
+		case bytes.HasPrefix(trimmed, gzipMagic):
+			gz, err := gzip.NewReader(bytes.NewReader(trimmed))
+			if err != nil {
+				return rel, "", fmt.Errorf("gzip: %w", err)
+			}
+			body, err := io.ReadAll(gz)
+			gz.Close()
+			if err != nil {
+				return rel, "", fmt.Errorf("gzip: %w", err)
+			}
+			data = body
+			path = append(path, "gzip")
+
+		default:
+			raw, err := base64.StdEncoding.DecodeString(string(trimmed))
+			if err != nil {
+				return rel, "", fmt.Errorf("base64: %w", err)
+			}
+			data = raw
+			path = append(path, "base64")
+		}
+	}
+
+	return rel, "", fmt.Errorf("no JSON after %s", strings.Join(path, "+"))
+}
+
+// parseHelmSecretName splits the name of a Helm 3 release secret,
+// sh.helm.release.v1.<release>.v<revision>, or of a Helm 2 release ConfigMap,
+// <release>.v<revision>, into the release and its revision.
+// Release names may contain dots, so the revision is the last .v<N>;
+// ok is false for names of neither form, f/e sh.helm.release.v1.app.v0 or app.v1x.
+func parseHelmSecretName(name string) (release string, revision int, ok bool) {
+	name = strings.TrimPrefix(name, secretNamePrefix)
+	i := strings.LastIndex(name, ".v")
+	if i <= 0 {
+		return "", 0, false
+	}
+	digits := name[i+len(".v"):]
+	if strings.TrimLeft(digits, "0123456789") != "" {
+		return "", 0, false
+	}
+	revision, err := strconv.Atoi(digits)
+	if err != nil || revision <= 0 {
+		return "", 0, false
+	}
+	return name[:i], revision, true
+}
@@ -0,0 +1,174 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseHelmSecretName(t *testing.T) {
+	tests := []struct {
+		in           string
+		wantRelease  string
+		wantRevision int
+		wantOK       bool
+	}{
+		{"sh.helm.release.v1.app.v3", "app", 3, true},
+		{"sh.helm.release.v1.my.app.v12", "my.app", 12, true},
+		{"sh.helm.release.v1.app.v2.v7", "app.v2", 7, true},
+		// Helm v2 names its ConfigMaps <release>.v<revision>
+		{"app.v1", "app", 1, true},
+		{"my.app.v4", "my.app", 4, true},
+		{"sh.helm.release.v1.app.v0", "", 0, false},
+		{"sh.helm.release.v1.app.v1x", "", 0, false},
+		{"sh.helm.release.v1.app", "", 0, false},
+		{"app", "", 0, false},
+		{".v1", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		release, revision, ok := parseHelmSecretName(tt.in)
+		if release != tt.wantRelease || revision != tt.wantRevision || ok != tt.wantOK {
+			t.Errorf("parseHelmSecretName(%q) = %q, %d, %v; want %q, %d, %v",
+				tt.in, release, revision, ok, tt.wantRelease, tt.wantRevision, tt.wantOK)
+		}
+	}
+}
+
+// The fixtures hold the release record of a Helm 3 release secret: as JSON,
+// as the release key of the secret's data holds it and as read from the
+// data of the secret encoded once more.
+func TestDecodeRelease(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		wantPath string
+	}{
+		{"release.json", "plain JSON"},
+		{"release.b64gz", "base64+gzip"},
+		{"release.b64b64gz", "base64+base64+gzip"},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, path, err := decodeRelease(data)
+		if err != nil {
+			t.Errorf("decodeRelease(%s): %v", tt.fixture, err)
+			continue
+		}
+		if path != tt.wantPath {
+			t.Errorf("decodeRelease(%s) path = %q, want %q", tt.fixture, path, tt.wantPath)
+		}
+		if rel.Name != "web" || rel.Namespace != "shop" || rel.Version != 2 || rel.Info.Status != statusDeployed {
+			t.Errorf("decodeRelease(%s) = %s/%s v%d %s, want shop/web v2 deployed",
+				tt.fixture, rel.Namespace, rel.Name, rel.Version, rel.Info.Status)
+		}
+		metadata := rel.Chart.Metadata
+		if metadata.Name != "nginx" || metadata.Version != "15.14.0" || metadata.AppVersion != "1.25.4" {
+			t.Errorf("decodeRelease(%s) chart = %s %s %s, want nginx 15.14.0 1.25.4",
+				tt.fixture, metadata.Name, metadata.Version, metadata.AppVersion)
+		}
+	}
+}
+
+func TestDecodeReleaseMalformed(t *testing.T) {
+	for _, data := range []string{"", "not base64!", "{not json", "H4sIAAAA"} {
+		if _, _, err := decodeRelease([]byte(data)); err == nil {
+			t.Errorf("decodeRelease(%q) succeeded, want an error", data)
+		}
+	}
+}
+
+// releaseSecret returns the release secret Helm 3 stores for revision of
+// the release of testdata/release.json renamed to name in namespace.
+func releaseSecret(tb testing.TB, namespace, name string, revision int, status string) *corev1.Secret {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "release.json"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		tb.Fatal(err)
+	}
+	record["name"] = name
+	record["namespace"] = namespace
+	record["version"] = revision
+	record["info"].(map[string]interface{})["status"] = status
+	data, err = json.Marshal(record)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(data)
+	gz.Close()
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, revision),
+			Namespace: namespace,
+			Labels:    map[string]string{"owner": "helm", "name": name, "status": status},
+		},
+		Type: "helm.sh/release.v1",
+		Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(gzipped.Bytes()))},
+	}
+}
+
+func BenchmarkCollectReleases(b *testing.B) {
+	var secrets []runtime.Object
+	for i := range 500 {
+		namespace := fmt.Sprintf("team-%d", i%20)
+		secrets = append(secrets,
+			releaseSecret(b, namespace, fmt.Sprintf("app-%d", i), 1, "superseded"),
+			releaseSecret(b, namespace, fmt.Sprintf("app-%d", i), 2, statusDeployed),
+		)
+	}
+	client := fake.NewSimpleClientset(secrets...)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		releases, decodeErrors, err := CollectReleases(ctx, client, Options{LabelSelector: "owner=helm"})
+		if err != nil || len(decodeErrors) > 0 || len(releases) != 500 {
+			b.Fatalf("CollectReleases returned %d releases, %v, %v", len(releases), decodeErrors, err)
+		}
+	}
+}
+
+func TestCollectReleasesLatestRevision(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		releaseSecret(t, "shop", "web", 3, statusDeployed),
+		releaseSecret(t, "shop", "web", 4, "failed"),
+		// a failed upgrade can leave an older revision marked deployed
+		releaseSecret(t, "shop", "web", 2, statusDeployed),
+		releaseSecret(t, "shop", "web.v2", 1, statusDeployed),
+		releaseSecret(t, "blog", "web", 1, statusDeployed),
+	)
+	releases, decodeErrors, err := CollectReleases(context.Background(), client, Options{})
+	if err != nil || len(decodeErrors) > 0 {
+		t.Fatalf("CollectReleases() = %v, %v", decodeErrors, err)
+	}
+
+	got := make(map[string]int)
+	for _, r := range releases {
+		got[r.Namespace+"/"+r.Name] = r.Version
+	}
+	want := map[string]int{"shop/web": 3, "shop/web.v2": 1, "blog/web": 1}
+	if len(releases) != len(want) || !maps.Equal(got, want) {
+		t.Errorf("CollectReleases() revisions = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,5 @@
+// Package inventorypb holds the gRPC API the scraper sends reports to with
+// API_TRANSPORT=grpc, generated from inventory.proto.
+package inventorypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative inventory.proto
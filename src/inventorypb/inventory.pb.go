@@ -0,0 +1,342 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: inventory.proto
+
+package inventorypb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ClusterInfo is the report of a cluster, with the fields of the JSON payload
+// of the same name.
+type ClusterInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SchemaVersion string                 `protobuf:"bytes,1,opt,name=schema_version,json=schemaVersion,proto3" json:"schema_version,omitempty"`
+	ClusterName   string                 `protobuf:"bytes,2,opt,name=cluster_name,json=clusterName,proto3" json:"cluster_name,omitempty"`
+	KubeVersion   string                 `protobuf:"bytes,3,opt,name=kube_version,json=kubeVersion,proto3" json:"kube_version,omitempty"`
+	Labels        map[string]string      `protobuf:"bytes,4,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	HelmCharts    []*HelmChartInfo       `protobuf:"bytes,5,rep,name=helm_charts,json=helmCharts,proto3" json:"helm_charts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClusterInfo) Reset() {
+	*x = ClusterInfo{}
+	mi := &file_inventory_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClusterInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClusterInfo) ProtoMessage() {}
+
+func (x *ClusterInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClusterInfo.ProtoReflect.Descriptor instead.
+func (*ClusterInfo) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ClusterInfo) GetSchemaVersion() string {
+	if x != nil {
+		return x.SchemaVersion
+	}
+	return ""
+}
+
+func (x *ClusterInfo) GetClusterName() string {
+	if x != nil {
+		return x.ClusterName
+	}
+	return ""
+}
+
+func (x *ClusterInfo) GetKubeVersion() string {
+	if x != nil {
+		return x.KubeVersion
+	}
+	return ""
+}
+
+func (x *ClusterInfo) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *ClusterInfo) GetHelmCharts() []*HelmChartInfo {
+	if x != nil {
+		return x.HelmCharts
+	}
+	return nil
+}
+
+// HelmChartInfo is an application detected in the cluster.
+type HelmChartInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ChartName      string                 `protobuf:"bytes,1,opt,name=chart_name,json=chartName,proto3" json:"chart_name,omitempty"`
+	Category       string                 `protobuf:"bytes,2,opt,name=category,proto3" json:"category,omitempty"`
+	Version        string                 `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	Namespace      string                 `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Source         string                 `protobuf:"bytes,5,opt,name=source,proto3" json:"source,omitempty"`
+	Registry       string                 `protobuf:"bytes,6,opt,name=registry,proto3" json:"registry,omitempty"`
+	Repository     string                 `protobuf:"bytes,7,opt,name=repository,proto3" json:"repository,omitempty"`
+	Sidecar        bool                   `protobuf:"varint,8,opt,name=sidecar,proto3" json:"sidecar,omitempty"`
+	Count          int64                  `protobuf:"varint,9,opt,name=count,proto3" json:"count,omitempty"`
+	ContainerRoles []string               `protobuf:"bytes,10,rep,name=container_roles,json=containerRoles,proto3" json:"container_roles,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *HelmChartInfo) Reset() {
+	*x = HelmChartInfo{}
+	mi := &file_inventory_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HelmChartInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HelmChartInfo) ProtoMessage() {}
+
+func (x *HelmChartInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HelmChartInfo.ProtoReflect.Descriptor instead.
+func (*HelmChartInfo) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HelmChartInfo) GetChartName() string {
+	if x != nil {
+		return x.ChartName
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetCategory() string {
+	if x != nil {
+		return x.Category
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetRegistry() string {
+	if x != nil {
+		return x.Registry
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetRepository() string {
+	if x != nil {
+		return x.Repository
+	}
+	return ""
+}
+
+func (x *HelmChartInfo) GetSidecar() bool {
+	if x != nil {
+		return x.Sidecar
+	}
+	return false
+}
+
+func (x *HelmChartInfo) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *HelmChartInfo) GetContainerRoles() []string {
+	if x != nil {
+		return x.ContainerRoles
+	}
+	return nil
+}
+
+type SendClusterInfoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendClusterInfoResponse) Reset() {
+	*x = SendClusterInfoResponse{}
+	mi := &file_inventory_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendClusterInfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendClusterInfoResponse) ProtoMessage() {}
+
+func (x *SendClusterInfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_inventory_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendClusterInfoResponse.ProtoReflect.Descriptor instead.
+func (*SendClusterInfoResponse) Descriptor() ([]byte, []int) {
+	return file_inventory_proto_rawDescGZIP(), []int{2}
+}
+
+var File_inventory_proto protoreflect.FileDescriptor
+
+const file_inventory_proto_rawDesc = "" +
+	"\n" +
+	"\x0finventory.proto\x12\tkeepup.v1\"\xac\x02\n" +
+	"\vClusterInfo\x12%\n" +
+	"\x0eschema_version\x18\x01 \x01(\tR\rschemaVersion\x12!\n" +
+	"\fcluster_name\x18\x02 \x01(\tR\vclusterName\x12!\n" +
+	"\fkube_version\x18\x03 \x01(\tR\vkubeVersion\x12:\n" +
+	"\x06labels\x18\x04 \x03(\v2\".keepup.v1.ClusterInfo.LabelsEntryR\x06labels\x129\n" +
+	"\vhelm_charts\x18\x05 \x03(\v2\x18.keepup.v1.HelmChartInfoR\n" +
+	"helmCharts\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xaf\x02\n" +
+	"\rHelmChartInfo\x12\x1d\n" +
+	"\n" +
+	"chart_name\x18\x01 \x01(\tR\tchartName\x12\x1a\n" +
+	"\bcategory\x18\x02 \x01(\tR\bcategory\x12\x18\n" +
+	"\aversion\x18\x03 \x01(\tR\aversion\x12\x1c\n" +
+	"\tnamespace\x18\x04 \x01(\tR\tnamespace\x12\x16\n" +
+	"\x06source\x18\x05 \x01(\tR\x06source\x12\x1a\n" +
+	"\bregistry\x18\x06 \x01(\tR\bregistry\x12\x1e\n" +
+	"\n" +
+	"repository\x18\a \x01(\tR\n" +
+	"repository\x12\x18\n" +
+	"\asidecar\x18\b \x01(\bR\asidecar\x12\x14\n" +
+	"\x05count\x18\t \x01(\x03R\x05count\x12'\n" +
+	"\x0fcontainer_roles\x18\n" +
+	" \x03(\tR\x0econtainerRoles\"\x19\n" +
+	"\x17SendClusterInfoResponse2a\n" +
+	"\x10InventoryService\x12M\n" +
+	"\x0fSendClusterInfo\x12\x16.keepup.v1.ClusterInfo\x1a\".keepup.v1.SendClusterInfoResponseB%Z#keepup-helm-scraper/src/inventorypbb\x06proto3"
+
+var (
+	file_inventory_proto_rawDescOnce sync.Once
+	file_inventory_proto_rawDescData []byte
+)
+
+func file_inventory_proto_rawDescGZIP() []byte {
+	file_inventory_proto_rawDescOnce.Do(func() {
+		file_inventory_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_inventory_proto_rawDesc), len(file_inventory_proto_rawDesc)))
+	})
+	return file_inventory_proto_rawDescData
+}
+
+var file_inventory_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_inventory_proto_goTypes = []any{
+	(*ClusterInfo)(nil),             // 0: keepup.v1.ClusterInfo
+	(*HelmChartInfo)(nil),           // 1: keepup.v1.HelmChartInfo
+	(*SendClusterInfoResponse)(nil), // 2: keepup.v1.SendClusterInfoResponse
+	nil,                             // 3: keepup.v1.ClusterInfo.LabelsEntry
+}
+var file_inventory_proto_depIdxs = []int32{
+	3, // 0: keepup.v1.ClusterInfo.labels:type_name -> keepup.v1.ClusterInfo.LabelsEntry
+	1, // 1: keepup.v1.ClusterInfo.helm_charts:type_name -> keepup.v1.HelmChartInfo
+	0, // 2: keepup.v1.InventoryService.SendClusterInfo:input_type -> keepup.v1.ClusterInfo
+	2, // 3: keepup.v1.InventoryService.SendClusterInfo:output_type -> keepup.v1.SendClusterInfoResponse
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_inventory_proto_init() }
+func file_inventory_proto_init() {
+	if File_inventory_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_inventory_proto_rawDesc), len(file_inventory_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_inventory_proto_goTypes,
+		DependencyIndexes: file_inventory_proto_depIdxs,
+		MessageInfos:      file_inventory_proto_msgTypes,
+	}.Build()
+	File_inventory_proto = out.File
+	file_inventory_proto_goTypes = nil
+	file_inventory_proto_depIdxs = nil
+}
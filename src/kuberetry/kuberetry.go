@@ -0,0 +1,71 @@
+// Package kuberetry retries apiserver reads while the apiserver is
+// unavailable, f/e restarted during a control-plane upgrade.
+package kuberetry
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// baseDelay is the wait before the first retry, doubled per retry.
+const baseDelay = time.Second
+
+// Transport retries GET requests failing with a network error or a
+// 502/503/504 up to MaxRetries times. Other responses, f/e 403 Forbidden,
+// are returned right away, as is any other request.
+type Transport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+}
+
+// Wrap returns a rest.Config WrapTransport function adding the retries.
+func Wrap(maxRetries int) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &Transport{Base: rt, MaxRetries: maxRetries}
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.Base.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.Base.RoundTrip(req)
+		if !unavailable(resp, err) || attempt >= t.MaxRetries {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		delay := baseDelay << attempt
+		log.Printf("Kubernetes API unavailable for %s: %s, retrying in %s", req.URL.Path, reason(resp, err), delay)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// unavailable reports whether the apiserver couldn't be reached or
+// answered that it's temporarily unavailable.
+func unavailable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func reason(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
@@ -1,281 +1,1062 @@
 package main
 
 import (
-	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"keepup-helm-scraper/src/api"
+	"keepup-helm-scraper/src/clusters"
 	"keepup-helm-scraper/src/config"
+	"keepup-helm-scraper/src/crd"
+	"keepup-helm-scraper/src/kuberetry"
+	"keepup-helm-scraper/src/metrics"
+	"keepup-helm-scraper/src/objectstore"
+	"keepup-helm-scraper/src/payload"
+	"keepup-helm-scraper/src/preflight"
+	"keepup-helm-scraper/src/registry"
+	"keepup-helm-scraper/src/resolver"
 	"keepup-helm-scraper/src/rules"
+	"keepup-helm-scraper/src/runstatus"
+	"keepup-helm-scraper/src/scraper"
+	"keepup-helm-scraper/src/spool"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 )
 
-type HelmChartInfo struct {
-	ChartName string `json:"chart_name"`
-	Version   string `json:"version"`
-	Namespace string `json:"namespace"`
-}
+func main() {
+	// needs no configuration, so it runs in CI without a cluster's environment
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLint(os.Args[2:]))
+	}
 
-type ClusterInfo struct {
-	ClusterName string          `json:"cluster_name"`
-	KubeVersion string          `json:"kube_version"`
-	HelmCharts  []HelmChartInfo `json:"helm_charts"`
-}
+	if name, value, ok := strings.Cut(config.GetEnvConfig().RULES_AUTH_HEADER, ":"); ok {
+		rules.URLHeader.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "test-rule":
+			os.Exit(runTestRule(os.Args[2:]))
+		case "verify-rules":
+			os.Exit(runVerifyRules(os.Args[2:]))
+		case "preflight":
+			os.Exit(runPreflight(context.Background()))
+		case "dump-images":
+			os.Exit(runDumpImages(context.Background()))
+		default:
+			log.Fatalf("Unknown command: %s", os.Args[1])
+		}
+	}
 
-func main() {
 	ctx := context.Background()
+	cfg := config.GetEnvConfig()
 
-	kubeconfig, err := rest.InClusterConfig()
-	if err != nil {
-		log.Fatalf("failed to get cluster config: %v", err)
+	var loadedRules []rules.Rule
+	var crds []crd.Resource
+	if cfg.ScanImages() || cfg.PARSE_HELM_MANIFEST {
+		var err error
+		loadedRules, err = rules.LoadRules(cfg.RULES_FILE, cfg.RULES_OVERLAY_FILE)
+		if err != nil {
+			log.Printf("SCAN_MODE=%s requires a valid RULES_FILE: %v", cfg.SCAN_MODE, err)
+			log.Fatal(rulesRemediation(err))
+		}
+
+		crds, err = scannedCRDs()
+		if err != nil {
+			log.Fatalf("Invalid SCAN_CRDS: %v", err)
+		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	// the helm section is optional, so is the rules file when only Helm is scanned
+	var helmRules []rules.HelmRule
+	if cfg.ScanHelm() {
+		var err error
+		helmRules, err = rules.LoadHelmRules(cfg.RULES_FILE, cfg.RULES_OVERLAY_FILE)
+		if err != nil && !errors.Is(err, rules.ErrRulesFileNotFound) {
+			log.Printf("Invalid helm rules in RULES_FILE: %v", err)
+			log.Fatal(rulesRemediation(err))
+		}
+	}
+
+	opts := scraperOptions(crds, helmRules)
+
+	encoder, err := payload.NewEncoder(cfg.PAYLOAD_TEMPLATE, cfg.PayloadFieldMap())
 	if err != nil {
-		log.Fatalf("failed to create clientset: %v", err)
+		log.Fatalf("Can't load PAYLOAD_TEMPLATE: %v", err)
 	}
 
-	rules, err := rules.LoadRules(config.GetEnvConfig().RULES_FILE)
+	out, err := reportOutput()
 	if err != nil {
-		log.Fatalf("Can't configure RULES_FILE: %v", err)
+		log.Fatalf("Can't open OUTPUT_FILE: %v", err)
+	}
+
+	var bucket *objectstore.Bucket
+	if cfg.OUTPUT_S3 != "" {
+		bucket, err = objectstore.New(ctx, cfg.OUTPUT_S3, cfg.OUTPUT_S3_ENDPOINT, cfg.OUTPUT_S3_KEY)
+		if err != nil {
+			log.Fatalf("Can't configure OUTPUT_S3: %v", err)
+		}
+	}
+
+	if cfg.MODE == config.ModeInterval {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+		defer stop()
+		go exitAfterShutdownTimeout(ctx)
 	}
 
-	var versionRe = regexp.MustCompile(`(\d+)\.(\d+)(\.\d+)?`)
+	if cfg.CLUSTERS_CONFIG != "" {
+		if cfg.MODE == config.ModeInterval {
+			repeat(ctx, func() {
+				flushSpool()
+				runClusters(ctx, cfg.CLUSTERS_CONFIG, encoder, out, bucket, opts, loadedRules)
+			})
+			// a last try for the payloads the API didn't take, the one of a
+			// scrape stopped by the shutdown included
+			flushSpool()
+			return
+		}
+		flushSpool()
+		os.Exit(runClusters(ctx, cfg.CLUSTERS_CONFIG, encoder, out, bucket, opts, loadedRules))
+	}
 
-	imagesByNs, err := сollectNamespaceImages(ctx, clientset)
+	kubeconfig, err := rest.InClusterConfig()
+	if err != nil {
+		log.Fatalf("failed to get cluster config: %v", err)
+	}
+
+	clientset, dynamicClient, err := newClients(kubeconfig)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if _, err := clientset.Discovery().ServerVersion(); err != nil {
+		log.Fatalf("Kubernetes API not reachable: %v", err)
+	}
 
-	uniqImagesByNs := make(map[string]map[string]string)
-	for ns, images := range imagesByNs {
-		log.Println("Processing namespace:", ns)
-		for _, img := range images {
-			for _, rule := range rules {
-				if rule.DetectionRegex.MatchString(img) {
-					log.Printf("Matched %s -> %s\n", img, rule.ApplicationName)
-					if v, ok := normalizeSemVer(rule.VersionRegex.FindString(img), versionRe); ok {
-						log.Printf("Normalized %-90s -> %s\n", img, v)
-						if _, ok := uniqImagesByNs[ns]; !ok {
-							uniqImagesByNs[ns] = make(map[string]string)
-						}
-						uniqImagesByNs[ns][rule.ApplicationName] = v
-					} else {
-						log.Printf("%-90s -> no version\n", img)
-					}
-				}
+	if cfg.SERVE_ADDR != "" {
+		opts := withVersionHistory(ctx, clientset, withMetadataCache(opts, ""), "")
+		s := newScraper(clientset, dynamicClient, "", opts, loadedRules)
+		log.Fatal(serveComponents(cfg.SERVE_ADDR, func(ctx context.Context) (scraper.ClusterInfo, error) {
+			output, err := s.Scrape(ctx)
+			if err == nil {
+				saveVersionHistory(ctx, clientset, opts.VersionHistory)
 			}
+			return output, err
+		}))
+	}
+
+	if cfg.MODE == config.ModeInterval {
+		opts, err := withScanCache(opts, "", kubeconfig)
+		if err != nil {
+			log.Fatal(err)
 		}
+		opts = withVersionHistory(ctx, clientset, withMetadataCache(opts, ""), "")
+		repeat(ctx, func() {
+			flushSpool()
+			if err := scrapeAndSend(ctx, clientset, dynamicClient, "", encoder, out, bucket, opts, loadedRules); err != nil {
+				log.Printf("Scrape failed: %v", err)
+			}
+		})
+		flushSpool()
+		return
 	}
 
-	var imagesInstalled []HelmChartInfo
-	for ns, versionedImage := range uniqImagesByNs {
-		for i, v := range versionedImage {
-			imagesInstalled = append(imagesInstalled, HelmChartInfo{
-				ChartName: i,
-				Version:   v,
-				Namespace: ns,
-			})
+	flushSpool()
+	if err := scrapeAndSend(ctx, clientset, dynamicClient, "", encoder, out, bucket, opts, loadedRules); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// repeat runs run right away and then every SCRAPE_INTERVAL_SECONDS until
+// the context is done, f/e by SIGTERM, which also cancels a running scrape.
+func repeat(ctx context.Context, run func()) {
+	interval := time.Duration(config.GetEnvConfig().SCRAPE_INTERVAL_SECONDS) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		run()
+		log.Printf("Next scrape in %s", interval)
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping")
+			return
+		case <-ticker.C:
 		}
 	}
+}
+
+// exitAfterShutdownTimeout exits SHUTDOWN_TIMEOUT_SECONDS after the signal
+// canceling ctx, so sending what the stopped scrape collected and flushing
+// the spool can't outlast the termination grace period of the pod. A payload
+// still being sent then is left in the spool, see scrapeAndSend.
+func exitAfterShutdownTimeout(ctx context.Context) {
+	<-ctx.Done()
+	timeout := time.Duration(config.GetEnvConfig().SHUTDOWN_TIMEOUT_SECONDS) * time.Second
+	log.Printf("Shutting down, sending what was scraped for up to %s", timeout)
+	time.Sleep(timeout)
+	log.Printf("Still sending after %s, exiting", timeout)
+	os.Exit(0)
+}
 
-	clusterName := getClusterName()
-	kubeVersion := getKubernetesVersion(clientset)
-	output := ClusterInfo{
-		ClusterName: clusterName,
-		KubeVersion: kubeVersion,
-		HelmCharts:  imagesInstalled,
+// flushSpool resends the payloads spooled by previous runs.
+func flushSpool() {
+	if sp, ok := payloadSpool(); ok {
+		if err := sp.Flush(resendPayload); err != nil {
+			log.Printf("Spooled payloads left for the next run: %v", err)
+		}
+	}
+}
+
+// sendPayload sends the encoded report with the API_TRANSPORT.
+func sendPayload(data []byte) error {
+	if config.GetEnvConfig().API_TRANSPORT == config.TransportGRPC {
+		return api.SendGRPC(data)
 	}
-	jsonData, err := json.MarshalIndent(output, "", "  ")
+	return api.SendData(data)
+}
+
+// scannedCRDs returns the custom resources of SCAN_CRDS, SCAN_ROLLOUTS
+// and SCAN_DEPLOYMENTCONFIGS.
+func scannedCRDs() ([]crd.Resource, error) {
+	cfg := config.GetEnvConfig()
+	crds, err := crd.ParseResources(cfg.SCAN_CRDS)
 	if err != nil {
-		log.Fatalf("Failed to convert to JSON: %v", err)
+		return nil, err
+	}
+	if cfg.SCAN_ROLLOUTS {
+		crds = append(crds, crd.Rollouts)
 	}
+	if cfg.SCAN_DEPLOYMENTCONFIGS {
+		crds = append(crds, crd.DeploymentConfigs)
+	}
+	return crds, nil
+}
 
-	log.Printf("Sending versions: %s", imagesInstalled)
-	sendDataToAPI(jsonData)
+// rulesRemediation tells how to fix a rules loading error.
+func rulesRemediation(err error) string {
+	var compileErr *rules.RuleCompileError
+	var versionErr *rules.VersionError
+	switch {
+	case errors.Is(err, rules.ErrRulesFileNotFound):
+		return "Point RULES_FILE to the mounted rules file, or use SCAN_MODE=helm to scan without rules"
+	case errors.Is(err, rules.ErrNoRules):
+		return "Add detection rules to the docker section of the rules file"
+	case errors.As(err, &versionErr):
+		return fmt.Sprintf("Set version: %q in the rules file, after checking it matches this schema", rules.FileVersion)
+	case errors.As(err, &compileErr):
+		return fmt.Sprintf("Fix %s in the rules file, then check it with the test-rule command", compileErr.Field)
+	default:
+		return "Check that the rules file is valid YAML"
+	}
 }
 
-func сollectNamespaceImages(
-	ctx context.Context,
-	client kubernetes.Interface,
-) (map[string][]string, error) {
+// newClients creates the API clients, rate limited by KUBE_QPS and KUBE_BURST.
+// Reads are retried KUBE_MAX_RETRIES times while the apiserver is unavailable.
+func newClients(kubeconfig *rest.Config) (*kubernetes.Clientset, dynamic.Interface, error) {
+	cfg := config.GetEnvConfig()
+	kubeconfig.QPS = float32(cfg.KUBE_QPS)
+	kubeconfig.Burst = cfg.KUBE_BURST
+	kubeconfig.UserAgent = cfg.UserAgent()
+	kubeconfig.Wrap(kuberetry.Wrap(cfg.KUBE_MAX_RETRIES))
 
-	// accumulate to internal set
-	acc := make(map[string]map[string]int)
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
 
-	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	dynamicClient, err := dynamic.NewForConfig(kubeconfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
+	return clientset, dynamicClient, nil
+}
 
-	for _, ns := range namespaces.Items {
-		nsName := ns.Name
+// scanCaches are the ScanCaches of INCREMENTAL_SCAN by cluster name,
+// kept over the rounds of the interval mode.
+var scanCaches = make(map[string]*scraper.ScanCache)
 
-		if _, ok := acc[nsName]; !ok {
-			acc[nsName] = make(map[string]int)
-		}
+// withScanCache returns the options with the ScanCache of the cluster
+// when INCREMENTAL_SCAN is set.
+func withScanCache(opts scraper.Options, clusterName string, kubeconfig *rest.Config) (scraper.Options, error) {
+	if !config.GetEnvConfig().INCREMENTAL_SCAN {
+		return opts, nil
+	}
 
-		if err := collectFromDeployments(ctx, client, nsName, acc); err != nil {
-			return nil, err
-		}
-		if err := collectFromStatefulSets(ctx, client, nsName, acc); err != nil {
-			return nil, err
-		}
-		if err := collectFromDaemonSets(ctx, client, nsName, acc); err != nil {
-			return nil, err
+	cache, ok := scanCaches[clusterName]
+	if !ok {
+		client, err := metadata.NewForConfig(kubeconfig)
+		if err != nil {
+			return opts, fmt.Errorf("failed to create metadata client: %w", err)
 		}
+		cache = scraper.NewScanCache(client)
+		scanCaches[clusterName] = cache
 	}
+	opts.ScanCache = cache
+	return opts, nil
+}
 
-	// normalize map[string]map[string]struct{} -> map[string][]string
-	result := make(map[string][]string)
-	for ns, images := range acc {
-		for img := range images {
-			result[ns] = append(result[ns], img)
-		}
+// metadataCaches are the MetadataCaches by cluster name, kept over the
+// scrapes of the interval and pull modes.
+var metadataCaches = make(map[string]*scraper.MetadataCache)
+
+// withMetadataCache returns the options with the MetadataCache of the
+// cluster, unless METADATA_CACHE_TTL is 0. A one-shot run scrapes once,
+// so its cache is never hit.
+func withMetadataCache(opts scraper.Options, clusterName string) scraper.Options {
+	ttl := config.GetEnvConfig().MetadataCacheTTL()
+	if ttl == 0 {
+		return opts
 	}
 
-	return result, nil
+	cache, ok := metadataCaches[clusterName]
+	if !ok {
+		cache = scraper.NewMetadataCache(ttl)
+		metadataCaches[clusterName] = cache
+	}
+	opts.MetadataCache = cache
+	return opts
 }
 
-func collectImages(
-	spec corev1.PodSpec,
-	ns string,
-	acc map[string]map[string]int,
-) {
-	for _, c := range spec.Containers {
-		acc[ns][c.Image] = 1
+// versionHistories are the VersionHistories of REPORT_DOWNGRADES by
+// cluster name, kept over the scrapes of the interval and pull modes.
+var versionHistories = make(map[string]*scraper.VersionHistory)
+
+// withVersionHistory returns the options with the VersionHistory of the
+// cluster when REPORT_DOWNGRADES is set, starting from the versions kept in
+// its STATUS_CONFIGMAP, if set, by the previous run.
+func withVersionHistory(ctx context.Context, clientset kubernetes.Interface, opts scraper.Options, clusterName string) scraper.Options {
+	cfg := config.GetEnvConfig()
+	if !cfg.REPORT_DOWNGRADES {
+		return opts
+	}
+
+	history, ok := versionHistories[clusterName]
+	if !ok {
+		history = scraper.NewVersionHistory()
+		if namespace, name, ok := strings.Cut(cfg.STATUS_CONFIGMAP, "/"); ok {
+			data, err := runstatus.ReadVersions(ctx, clientset, namespace, name)
+			if err != nil {
+				log.Printf("Failed to read the versions of the previous run from STATUS_CONFIGMAP: %v", err)
+			} else if data != nil {
+				if err := history.UnmarshalJSON(data); err != nil {
+					log.Printf("Ignoring the versions of the previous run in STATUS_CONFIGMAP: %v", err)
+				}
+			}
+		}
+		versionHistories[clusterName] = history
+	}
+	opts.VersionHistory = history
+	return opts
+}
+
+// saveVersionHistory keeps the versions of the history in STATUS_CONFIGMAP
+// for the next run, when both are set, logging failures.
+func saveVersionHistory(ctx context.Context, clientset kubernetes.Interface, history *scraper.VersionHistory) {
+	namespace, name, ok := strings.Cut(config.GetEnvConfig().STATUS_CONFIGMAP, "/")
+	if history == nil || !ok {
+		return
 	}
-	for _, c := range spec.InitContainers {
-		acc[ns][c.Image] = 1
+	data, err := history.MarshalJSON()
+	if err == nil {
+		err = runstatus.WriteVersions(ctx, clientset, namespace, name, data)
+	}
+	if err != nil {
+		log.Printf("Failed to keep the versions in STATUS_CONFIGMAP: %v", err)
 	}
 }
 
-func collectFromDeployments(
+// runClusters scrapes every cluster of the clusters file and sends a report
+// per cluster. A failing cluster doesn't stop the others, but fails the run.
+func runClusters(
 	ctx context.Context,
-	client kubernetes.Interface,
-	ns string,
-	acc map[string]map[string]int,
-) error {
-	deploys, err := client.AppsV1().Deployments(ns).List(ctx, metav1.ListOptions{})
+	path string,
+	encoder *payload.Encoder,
+	out io.Writer,
+	bucket *objectstore.Bucket,
+	opts scraper.Options,
+	rules []rules.Rule,
+) int {
+	list, err := clusters.Load(path)
 	if err != nil {
-		return err
+		log.Printf("Can't load CLUSTERS_CONFIG: %v", err)
+		return 1
 	}
 
-	for _, d := range deploys.Items {
-		collectImages(d.Spec.Template.Spec, ns, acc)
+	failed := 0
+	for _, c := range list {
+		if ctx.Err() != nil {
+			log.Printf("Shutting down, skipping cluster %s", c.Name)
+			continue
+		}
+		log.Println("Processing cluster:", c.Name)
+
+		err := func() error {
+			kubeconfig, err := c.RESTConfig()
+			if err != nil {
+				return fmt.Errorf("failed to get cluster config: %w", err)
+			}
+			clientset, dynamicClient, err := newClients(kubeconfig)
+			if err != nil {
+				return err
+			}
+			if _, err := clientset.Discovery().ServerVersion(); err != nil {
+				return fmt.Errorf("Kubernetes API not reachable: %w", err)
+			}
+			opts, err := withScanCache(opts, c.Name, kubeconfig)
+			if err != nil {
+				return err
+			}
+			opts = withVersionHistory(ctx, clientset, withMetadataCache(opts, c.Name), c.Name)
+			return scrapeAndSend(ctx, clientset, dynamicClient, c.Name, encoder, out, bucket, opts, rules)
+		}()
+		if err != nil {
+			log.Printf("Failed to scrape cluster %s: %v", c.Name, err)
+			failed++
+		}
 	}
-	return nil
+
+	if failed > 0 {
+		log.Printf("%d of %d clusters failed", failed, len(list))
+		return 1
+	}
+	return 0
 }
 
-func collectFromStatefulSets(
+// scrapeAndSend collects the cluster report and sends it to the API,
+// writing it to out and uploading the payload to bucket as well unless
+// they're nil.
+func scrapeAndSend(
 	ctx context.Context,
-	client kubernetes.Interface,
-	ns string,
-	acc map[string]map[string]int,
-) error {
-	sets, err := client.AppsV1().StatefulSets(ns).List(ctx, metav1.ListOptions{})
+	clientset *kubernetes.Clientset,
+	dynamicClient dynamic.Interface,
+	clusterName string,
+	encoder *payload.Encoder,
+	out io.Writer,
+	bucket *objectstore.Bucket,
+	opts scraper.Options,
+	rules []rules.Rule,
+) (err error) {
+	var output scraper.ClusterInfo
+	// the error of sending the payload, which is spooled rather than returned
+	var sendErr error
+	// ctx is canceled by a shutdown in interval mode, which stops the scrape
+	// but not the sending of what it collected
+	sendCtx := context.WithoutCancel(ctx)
+	if ref := config.GetEnvConfig().STATUS_CONFIGMAP; ref != "" {
+		defer func() {
+			writeStatus(sendCtx, clientset, ref, clusterName, output, err, sendErr)
+		}()
+	}
+
+	output, err = newScraper(clientset, dynamicClient, clusterName, opts, rules).Scrape(ctx)
 	if err != nil {
 		return err
 	}
+	saveVersionHistory(sendCtx, clientset, opts.VersionHistory)
+
+	if config.GetEnvConfig().FAIL_ON_EMPTY && len(output.HelmCharts) == 0 {
+		return fmt.Errorf("nothing detected and FAIL_ON_EMPTY is set, not sending an empty report")
+	}
+
+	if out != nil {
+		ndjson := config.GetEnvConfig().OUTPUT_FORMAT == config.OutputFormatNDJSON
+		if err := payload.WriteReport(out, output, ndjson, config.GetEnvConfig().OUTPUT_INDENT); err != nil {
+			return fmt.Errorf("failed to write the report: %w", err)
+		}
+	}
+
+	if bucket != nil {
+		data, err := encoder.Encode(output)
+		if err != nil {
+			return fmt.Errorf("failed to encode payload: %w", err)
+		}
+		if key, err := bucket.Put(sendCtx, output.ClusterName, data, config.GetEnvConfig().API_CONTENT_TYPE); err != nil {
+			log.Printf("Failed to upload the payload to OUTPUT_S3: %v", err)
+		} else {
+			log.Printf("Uploaded the payload to %s", key)
+		}
+	}
+
+	if config.GetEnvConfig().LOG_PAYLOAD {
+		logReport(output)
+	}
+
+	stream := false
+	if config.GetEnvConfig().API_STREAM {
+		var reason string
+		if stream, reason = api.CanStream(); !stream {
+			log.Printf("Sending the payload buffered, API_STREAM is set but %s", reason)
+		}
+	}
+	if stream {
+		log.Printf("Streaming versions: %v", output.HelmCharts)
+		if sendErr = api.StreamData(output); sendErr != nil {
+			log.Printf("Failed to send data to API: %v", sendErr)
+			// only now the payload is needed as a whole
+			data, err := encoder.Encode(output)
+			if err != nil {
+				return fmt.Errorf("failed to encode payload: %w", err)
+			}
+			spoolPayload(data, sendErr)
+		}
+		return nil
+	}
+
+	var data []byte
+	if config.GetEnvConfig().API_TRANSPORT == config.TransportGRPC {
+		data, err = payload.EncodeProto(output)
+	} else {
+		data, err = encoder.Encode(output)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	if _, ok := payloadSpool(); ok && ctx.Err() != nil {
+		// shutting down: the final flush sends it, and leaves it spooled for
+		// the next run if SHUTDOWN_TIMEOUT_SECONDS cuts it short
+		sendErr = errors.New("shutting down, spooled for the final flush")
+		spoolPayload(data, sendErr)
+		return nil
+	}
 
-	for _, s := range sets.Items {
-		collectImages(s.Spec.Template.Spec, ns, acc)
+	log.Printf("Sending versions: %v", output.HelmCharts)
+	if sendErr = sendPayload(data); sendErr != nil {
+		log.Printf("Failed to send data to API: %v", sendErr)
+		spoolPayload(data, sendErr)
 	}
 	return nil
 }
 
-func collectFromDaemonSets(
+// resendPayload sends a spooled payload and reports whether a failure is
+// worth retrying on the next run. A payload encoded for another
+// API_TRANSPORT than the current one can't be sent.
+func resendPayload(data []byte, encoding string) (bool, error) {
+	if encoding != payloadEncoding() {
+		return false, fmt.Errorf("encoded as %s, API_TRANSPORT %s sends %s", encoding, config.GetEnvConfig().API_TRANSPORT, payloadEncoding())
+	}
+	err := sendPayload(data)
+	return !errors.Is(err, api.ErrRejected), err
+}
+
+// payloadEncoding returns the spool encoding of the payloads of the API_TRANSPORT.
+func payloadEncoding() string {
+	if config.GetEnvConfig().API_TRANSPORT == config.TransportGRPC {
+		return spool.EncodingProto
+	}
+	return spool.EncodingJSON
+}
+
+// writeStatus records the outcome of a scrape in the STATUS_CONFIGMAP
+// namespace/name of the scraped cluster, logging failures.
+func writeStatus(
 	ctx context.Context,
-	client kubernetes.Interface,
-	ns string,
-	acc map[string]map[string]int,
-) error {
-	sets, err := client.AppsV1().DaemonSets(ns).List(ctx, metav1.ListOptions{})
+	clientset kubernetes.Interface,
+	ref string,
+	clusterName string,
+	output scraper.ClusterInfo,
+	scrapeErr error,
+	sendErr error,
+) {
+	status := runstatus.Status{
+		Time:         time.Now(),
+		Cluster:      cmp.Or(output.ClusterName, clusterName),
+		Result:       runstatus.ResultOK,
+		Detections:   len(output.HelmCharts),
+		ScrapeErrors: len(output.Errors),
+		Version:      config.Version,
+	}
+	switch {
+	case scrapeErr != nil:
+		status.Result, status.Message = runstatus.ResultScrapeFailed, scrapeErr.Error()
+	case sendErr != nil:
+		status.Result, status.Message = runstatus.ResultSendFailed, sendErr.Error()
+	}
+
+	namespace, name, _ := strings.Cut(ref, "/")
+	if err := runstatus.Write(ctx, clientset, namespace, name, status); err != nil {
+		log.Printf("Failed to write the status to STATUS_CONFIGMAP: %v", err)
+	}
+}
+
+// logReport logs the report as indented JSON, whatever the payload sent
+// for it looks like.
+func logReport(output scraper.ClusterInfo) {
+	data, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
-		return err
+		log.Printf("Can't log the report: %v", err)
+		return
 	}
+	log.Printf("Report:\n%s", data)
+}
 
-	for _, d := range sets.Items {
-		collectImages(d.Spec.Template.Spec, ns, acc)
+// spoolPayload keeps the payload the API didn't accept for the next run,
+// when SPOOL_DIR is set, unless the API rejected it for good.
+func spoolPayload(data []byte, sendErr error) {
+	if errors.Is(sendErr, api.ErrRejected) {
+		log.Println("Not spooling the payload, the API rejected it")
+		return
+	}
+	if sp, ok := payloadSpool(); ok {
+		if err := sp.Save(data, payloadEncoding()); err != nil {
+			log.Printf("Failed to spool the payload: %v", err)
+		} else {
+			log.Printf("Spooled the payload to %s for the next run", sp.Dir)
+		}
 	}
-	return nil
 }
 
-func normalizeSemVer(imageVer string, versionRe *regexp.Regexp) (string, bool) {
-	m := versionRe.FindStringSubmatch(imageVer)
-	if m == nil {
-		return "", false
+// reportOutput returns where OUTPUT_FILE wants reports written, stdout for -
+// and nil when it's not set.
+func reportOutput() (io.Writer, error) {
+	switch path := config.GetEnvConfig().OUTPUT_FILE; path {
+	case "":
+		return nil, nil
+	case "-":
+		return os.Stdout, nil
+	default:
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
 	}
+}
 
-	major := m[1]
-	minor := m[2]
-	patch := m[3]
+// payloadSpool returns the spool of SPOOL_DIR, if set.
+func payloadSpool() (spool.Spool, bool) {
+	cfg := config.GetEnvConfig()
+	sp := spool.Spool{Dir: cfg.SPOOL_DIR, MaxBytes: int64(cfg.SPOOL_MAX_MB) << 20}
+	return sp, cfg.SPOOL_DIR != ""
+}
 
-	// set .0 as default patch version acc. to SemVer
-	if patch == "" {
-		patch = ".0"
+// scraperOptions configures the scrapers from the environment.
+func scraperOptions(crds []crd.Resource, helmRules []rules.HelmRule) scraper.Options {
+	cfg := config.GetEnvConfig()
+	var imageLabels *registry.Client
+	if cfg.RESOLVE_IMAGE_LABELS {
+		imageLabels = registry.NewClient(cfg.UserAgent())
 	}
+	var versionResolver *resolver.Command
+	if cfg.VERSION_RESOLVER_CMD != "" {
+		var err error
+		if versionResolver, err = resolver.New(cfg.VERSION_RESOLVER_CMD); err != nil {
+			log.Fatalf("Invalid VERSION_RESOLVER_CMD: %v", err)
+		}
+	}
+	includeApplications, err := scraper.ParseApplicationFilter(cfg.OUTPUT_APPLICATION_FILTER)
+	if err != nil {
+		log.Fatalf("Invalid OUTPUT_APPLICATION_FILTER: %v", err)
+	}
+	return scraper.Options{
+		ClusterName:           cfg.CLUSTER_NAME,
+		ClusterNameConfigMap:  cfg.CLUSTER_NAME_CONFIGMAP,
+		ClusterNameNodeLabel:  cfg.CLUSTER_NAME_NODE_LABEL,
+		Labels:                cfg.ReportLabels(),
+		KubeVersionFormat:     cfg.KUBE_VERSION_FORMAT,
+		Namespace:             cfg.TARGET_NAMESPACE,
+		ScanImages:            cfg.ScanImages(),
+		ScanHelm:              cfg.ScanHelm(),
+		Kinds:                 cfg.SCAN_KINDS,
+		CRDs:                  crds,
+		JobLookback:           time.Duration(cfg.JOB_LOOKBACK_HOURS) * time.Hour,
+		MaxNamespaces:         cfg.MAX_NAMESPACES,
+		MaxWorkloads:          cfg.MAX_WORKLOADS,
+		HelmLabelSelector:     cfg.HELM_LABEL_SELECTOR,
+		HelmMaxAge:            time.Duration(cfg.HELM_MAX_AGE_DAYS) * 24 * time.Hour,
+		HelmRules:             helmRules,
+		HelmReleaseLabels:     cfg.HELM_RELEASE_LABELS,
+		ParseHelmManifests:    cfg.PARSE_HELM_MANIFEST,
+		ImageLabels:           imageLabels,
+		VersionResolver:       versionResolver,
+		SidecarContainers:     cfg.SIDECAR_CONTAINERS,
+		ContainerNameFilter:   regexp.MustCompile(cfg.CONTAINER_NAME_FILTER),
+		ExcludeApplications:   scraper.CompileGlobs(cfg.EXCLUDE_APPLICATIONS),
+		ExcludeImages:         scraper.CompileGlobs(cfg.EXCLUDE_IMAGES),
+		IncludeApplications:   includeApplications,
+		RedactRegistries:      scraper.CompileGlobs(cfg.REDACT_REGISTRIES),
+		CollectResources:      cfg.COLLECT_RESOURCES,
+		CollectImageIDs:       cfg.COLLECT_IMAGE_IDS,
+		CollectAnnotations:    cfg.COLLECT_ANNOTATIONS,
+		DetectMesh:            cfg.DETECT_MESH,
+		CollectNodes:          cfg.COLLECT_NODES,
+		ReportNamespaces:      cfg.REPORT_NAMESPACES,
+		ReportVersionSkew:     cfg.REPORT_VERSION_SKEW,
+		ReportUnmatchedRules:  cfg.REPORT_UNMATCHED_RULES,
+		ReportUnmatchedImages: cfg.REPORT_UNMATCHED_IMAGES,
+		ReportTopN:            cfg.REPORT_TOP_N,
+	}
+}
 
-	return fmt.Sprintf("%s.%s%s", major, minor, patch), true
+// newScraper creates a scraper of the cluster. An empty cluster name
+// is looked up as configured by CLUSTER_NAME*.
+func newScraper(
+	clientset kubernetes.Interface,
+	dynamicClient dynamic.Interface,
+	clusterName string,
+	opts scraper.Options,
+	rules []rules.Rule,
+) *scraper.Scraper {
+	if clusterName != "" {
+		opts.ClusterName = clusterName
+	}
+	opts.DynamicClient = dynamicClient
+	return scraper.New(clientset, rules, opts)
 }
 
-func sendDataToAPI(jsonData []byte) {
-	apiURL := config.GetEnvConfig().API_URL
-	apiToken := config.GetEnvConfig().API_TOKEN
+// serveComponents serves GET /components, scraping the cluster on every request,
+// and with EXPOSE_INVENTORY_METRICS the same report as metrics on GET /metrics.
+// Concurrent requests wait for each other rather than scraping in parallel.
+func serveComponents(addr string, collect func(context.Context) (scraper.ClusterInfo, error)) error {
+	var mu sync.Mutex
 
-	if apiURL == "" || apiToken == "" {
-		log.Println("API_URL or API_TOKEN not set, skipping API request")
-		return
+	handle := func(contentType string, write func(io.Writer, scraper.ClusterInfo) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			output, err := collect(r.Context())
+			mu.Unlock()
+			if err != nil {
+				log.Printf("Failed to collect components: %v", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			if err := write(w, output); err != nil {
+				log.Printf("Failed to write components: %v", err)
+			}
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /components", handle("application/json", func(w io.Writer, output scraper.ClusterInfo) error {
+		return json.NewEncoder(w).Encode(output)
+	}))
+	if config.GetEnvConfig().EXPOSE_INVENTORY_METRICS {
+		mux.HandleFunc("GET /metrics", handle(metrics.ContentType, metrics.WriteInventory))
+	}
+
+	log.Printf("Serving components on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// runTestRule checks an image reference against the rules file and prints
+// every matched rule with its normalized version.
+// Usage: test-rule <image> [rules-file]
+func runTestRule(args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: test-rule <image> [rules-file]")
+		return 2
+	}
+
+	img := args[0]
+	rulesFile := config.GetEnvConfig().RULES_FILE
+	if len(args) == 2 {
+		rulesFile = args[1]
 	}
 
-	req, err := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonData))
+	loaded, err := rules.LoadRules(rulesFile, config.GetEnvConfig().RULES_OVERLAY_FILE)
 	if err != nil {
-		log.Printf("Failed to create request: %v", err)
-		return
+		fmt.Fprintf(os.Stderr, "Can't load rules from %s: %v\n", rulesFile, err)
+		return 1
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-token", apiToken)
+	var ictx scraper.ImageContext
+	if cmd := config.GetEnvConfig().VERSION_RESOLVER_CMD; cmd != "" {
+		versionResolver, err := resolver.New(cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid VERSION_RESOLVER_CMD: %v\n", err)
+			return 1
+		}
+		ictx.ResolveVersion = func() (string, error) {
+			return versionResolver.Resolve(context.Background(), img)
+		}
+	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	detections := scraper.DetectImage(img, ictx, loaded)
+	if len(detections) == 0 {
+		fmt.Printf("%s -> no rule matched\n", img)
+		return 1
+	}
+
+	for _, d := range detections {
+		if d.HasVersion {
+			fmt.Printf("%s -> %s %s (%s confidence)\n", img, d.Name(), d.Version, d.Confidence)
+		} else {
+			fmt.Printf("%s -> %s (no version)\n", img, d.Name())
+		}
+	}
+	return 0
+}
+
+// runVerifyRules runs the rules over every image of the corpus file and
+// reports the images whose detections differ from the expected ones.
+// Usage: verify-rules <corpus-file> [rules-file]
+func runVerifyRules(args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: verify-rules <corpus-file> [rules-file]")
+		return 2
+	}
+
+	rulesFile := config.GetEnvConfig().RULES_FILE
+	if len(args) == 2 {
+		rulesFile = args[1]
+	}
+
+	loaded, err := rules.LoadRules(rulesFile, config.GetEnvConfig().RULES_OVERLAY_FILE)
 	if err != nil {
-		log.Printf("Failed to send data to API: %v", err)
-		return
+		fmt.Fprintf(os.Stderr, "Can't load rules from %s: %v\n", rulesFile, err)
+		return 1
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		log.Println("Successfully sent data to API")
-	} else {
-		log.Printf("API request failed with status: %d", resp.StatusCode)
+	corpus, err := rules.LoadCorpus(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't load corpus from %s: %v\n", args[0], err)
+		return 1
+	}
+
+	describe := func(application, version string) string {
+		switch {
+		case application == "":
+			return "no match"
+		case version == "":
+			return application + " (no version)"
+		default:
+			return application + " " + version
+		}
+	}
+
+	mismatches := 0
+	for _, entry := range corpus {
+		want := describe(entry.Application, entry.Version)
+
+		var got []string
+		for _, d := range scraper.DetectImage(entry.Image, scraper.ImageContext{}, loaded) {
+			got = append(got, describe(d.Name(), d.Version))
+		}
+		if len(got) == 0 {
+			got = append(got, describe("", ""))
+		}
+
+		if len(got) != 1 || got[0] != want {
+			mismatches++
+			fmt.Printf("MISMATCH %s\n  - expected: %s\n  + detected: %s\n", entry.Image, want, strings.Join(got, ", "))
+		}
 	}
+
+	fmt.Printf("%d images verified, %d mismatches\n", len(corpus), mismatches)
+	if mismatches > 0 {
+		return 1
+	}
+	return 0
 }
 
-func getClusterName() string {
-	if envClusterName := os.Getenv("CLUSTER_NAME"); envClusterName != "" {
-		log.Printf("Using cluster name from environment: %s", envClusterName)
-		return envClusterName
+// runLint loads the rules file with all its validations and checks the
+// rules for mistakes loading accepts, see rules.Lint, without reading the
+// configuration. Errors fail the lint, warnings don't.
+// Usage: lint <rules-file>
+func runLint(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lint <rules-file>")
+		return 2
+	}
+
+	loaded, err := rules.LoadRules(args[0], "")
+	if err != nil {
+		fmt.Printf("ERROR %v\n", err)
+		return 1
+	}
+
+	errs, warnings := 0, 0
+	for _, issue := range rules.Lint(loaded) {
+		if issue.Severity == rules.LintError {
+			errs++
+		} else {
+			warnings++
+		}
+		fmt.Printf("%s %s: %s\n", strings.ToUpper(issue.Severity), issue.ApplicationName, issue.Message)
 	}
 
-	log.Println("Cluster name not found, using default 'minikube'")
-	return "minikube"
+	fmt.Printf("%d rules linted, %d errors, %d warnings\n", len(loaded), errs, warnings)
+	if errs > 0 {
+		return 1
+	}
+	return 0
 }
 
-func getKubernetesVersion(clientset *kubernetes.Clientset) string {
-	versionInfo, err := clientset.Discovery().ServerVersion()
+// runDumpImages prints the images of every workload as JSON, by cluster and
+// namespace, without running the rules or sending anything.
+// Usage: dump-images
+func runDumpImages(ctx context.Context) int {
+	cfg := config.GetEnvConfig()
+	crds, err := scannedCRDs()
 	if err != nil {
-		log.Println("Failed to fetch Kubernetes version, using 'unknown-version'")
-		return "unknown-version"
+		log.Printf("Invalid SCAN_CRDS: %v", err)
+		return 1
+	}
+	opts := scraperOptions(crds, nil)
+
+	type cluster struct {
+		name       string
+		kubeconfig *rest.Config
+		err        error
+	}
+	var list []cluster
+	if cfg.CLUSTERS_CONFIG != "" {
+		configs, err := clusters.Load(cfg.CLUSTERS_CONFIG)
+		if err != nil {
+			log.Printf("Can't load CLUSTERS_CONFIG: %v", err)
+			return 1
+		}
+		for _, c := range configs {
+			kubeconfig, err := c.RESTConfig()
+			list = append(list, cluster{c.Name, kubeconfig, err})
+		}
+	} else {
+		kubeconfig, err := rest.InClusterConfig()
+		list = append(list, cluster{"in-cluster", kubeconfig, err})
+	}
+
+	images := make(map[string]map[string][]scraper.CollectedImage)
+	for _, c := range list {
+		if c.err != nil {
+			log.Printf("Failed to get config of cluster %s: %v", c.name, c.err)
+			return 1
+		}
+		clientset, dynamicClient, err := newClients(c.kubeconfig)
+		if err != nil {
+			log.Printf("Failed to connect to cluster %s: %v", c.name, err)
+			return 1
+		}
+		images[c.name], err = newScraper(clientset, dynamicClient, "", opts, nil).CollectImages(ctx)
+		if err != nil {
+			log.Printf("Failed to collect the images of cluster %s: %v", c.name, err)
+			return 1
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(images); err != nil {
+		log.Printf("Failed to write the images: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// runPreflight checks the rules file, the RBAC permissions of the scrape in
+// every cluster and that API_URL is reachable, without sending any data.
+// Usage: preflight
+func runPreflight(ctx context.Context) int {
+	cfg := config.GetEnvConfig()
+	var checks []preflight.Check
+
+	crds, err := scannedCRDs()
+	checks = append(checks, preflight.Check{Name: "SCAN_CRDS is valid", Err: err})
+	if cfg.ScanImages() {
+		_, err := rules.LoadRules(cfg.RULES_FILE, cfg.RULES_OVERLAY_FILE)
+		checks = append(checks, preflight.Check{Name: "RULES_FILE " + cfg.RULES_FILE + " loads", Err: err})
+	}
+	if cfg.ScanHelm() {
+		_, err := rules.LoadHelmRules(cfg.RULES_FILE, cfg.RULES_OVERLAY_FILE)
+		if errors.Is(err, rules.ErrRulesFileNotFound) {
+			err = nil
+		}
+		checks = append(checks, preflight.Check{Name: "helm rules of RULES_FILE load", Err: err})
+	}
+
+	attrs := scrapeAccess(crds)
+	checkCluster := func(name string, kubeconfig *rest.Config, err error) {
+		if err == nil {
+			var clientset *kubernetes.Clientset
+			clientset, _, err = newClients(kubeconfig)
+			if err == nil {
+				for _, c := range preflight.Access(ctx, clientset, attrs) {
+					c.Name = name + ": " + c.Name
+					checks = append(checks, c)
+				}
+				return
+			}
+		}
+		checks = append(checks, preflight.Check{Name: name + ": cluster config", Err: err})
+	}
+
+	if cfg.CLUSTERS_CONFIG != "" {
+		list, err := clusters.Load(cfg.CLUSTERS_CONFIG)
+		checks = append(checks, preflight.Check{Name: "CLUSTERS_CONFIG loads", Err: err})
+		for _, c := range list {
+			kubeconfig, err := c.RESTConfig()
+			checkCluster(c.Name, kubeconfig, err)
+		}
+	} else {
+		kubeconfig, err := rest.InClusterConfig()
+		checkCluster("in-cluster", kubeconfig, err)
+	}
+
+	if cfg.SERVE_ADDR == "" {
+		checks = append(checks, preflight.Check{Name: "API_URL is reachable", Err: api.Probe()})
+	}
+
+	if preflight.Print(os.Stdout, checks) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// scrapeAccess lists the permissions a scrape needs as configured.
+func scrapeAccess(crds []crd.Resource) []authorizationv1.ResourceAttributes {
+	cfg := config.GetEnvConfig()
+	ns := cfg.TARGET_NAMESPACE
+
+	var attrs []authorizationv1.ResourceAttributes
+	if ns == "" {
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Resource: "namespaces"})
+	}
+	if cfg.ScanImages() {
+		for _, resource := range cfg.SCAN_KINDS {
+			attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Group: "apps", Resource: resource, Namespace: ns})
+		}
+		for _, res := range crds {
+			attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Group: res.GVR.Group, Resource: res.GVR.Resource, Namespace: ns})
+		}
+		if cfg.JOB_LOOKBACK_HOURS > 0 {
+			attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Group: "batch", Resource: "jobs", Namespace: ns})
+		}
+	}
+	if (cfg.ScanImages() && cfg.COLLECT_IMAGE_IDS) || cfg.DETECT_MESH {
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Resource: "pods", Namespace: ns})
+	}
+	if cfg.ScanHelm() {
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Resource: "secrets", Namespace: ns})
+	}
+	if cfg.COLLECT_NODES || (cfg.CLUSTER_NAME == "" && cfg.CLUSTER_NAME_NODE_LABEL != "") {
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "list", Resource: "nodes"})
+	}
+	if ref := strings.Split(cfg.CLUSTER_NAME_CONFIGMAP, "/"); cfg.CLUSTER_NAME == "" && len(ref) == 3 {
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "get", Resource: "configmaps", Namespace: ref[0], Name: ref[1]})
+	}
+	if namespace, name, ok := strings.Cut(cfg.STATUS_CONFIGMAP, "/"); ok {
+		for _, verb := range []string{"get", "update"} {
+			attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: verb, Resource: "configmaps", Namespace: namespace, Name: name})
+		}
+		attrs = append(attrs, authorizationv1.ResourceAttributes{Verb: "create", Resource: "configmaps", Namespace: namespace})
 	}
-	return versionInfo.GitVersion
+	return attrs
 }
@@ -0,0 +1,37 @@
+// Package metrics renders the report as OpenMetrics for Prometheus.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"keepup-helm-scraper/src/scraper"
+	"strings"
+)
+
+// ContentType of the OpenMetrics text format written by WriteInventory.
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteInventory writes an info series per detection of the report, f/e
+//
+//	keepup_component_info{cluster="prod",namespace="web",application="nginx",version="1.25.1",source="image"} 1
+//
+// so version adoption can be tracked over time. There is a series per
+// application, version and namespace, mind the cardinality on large clusters.
+func WriteInventory(w io.Writer, report scraper.ClusterInfo) error {
+	var b strings.Builder
+	b.WriteString("# TYPE keepup_component info\n")
+	b.WriteString("# HELP keepup_component Application detected in the cluster.\n")
+	for _, c := range report.HelmCharts {
+		fmt.Fprintf(&b, "keepup_component_info{cluster=%s,namespace=%s,application=%s,version=%s,source=%s} 1\n",
+			quote(report.ClusterName), quote(c.Namespace), quote(c.ChartName), quote(c.Version), quote(c.Source))
+	}
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// quote returns the label value as a quoted OpenMetrics string.
+func quote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
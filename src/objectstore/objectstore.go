@@ -0,0 +1,104 @@
+// Package objectstore uploads payloads to an S3 bucket, or one of an
+// S3-compatible store like MinIO, for a central process to ingest, so the
+// ingestion API needn't be reachable from every cluster.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// KeyData is what the key template gets.
+type KeyData struct {
+	ClusterName string
+	// Timestamp is the upload time in UTC, f/e 20240115T103000Z
+	Timestamp string
+	// Date is the upload day in UTC, f/e 2024-01-15, to partition by day
+	Date string
+}
+
+// Bucket uploads payloads under the prefix of an s3://bucket/prefix URL.
+type Bucket struct {
+	client *s3.Client
+	name   string
+	prefix string
+	key    *template.Template
+}
+
+// New returns the bucket of the s3://bucket/prefix URL, keying the payloads
+// with the Go text/template keyTemplate. Credentials and region are resolved
+// like the AWS CLI does, from the environment, shared config files, web
+// identity tokens or the instance metadata. A non-empty endpoint points
+// the client at an S3-compatible store, addressing buckets by path.
+func New(ctx context.Context, bucketURL, endpoint, keyTemplate string) (*Bucket, error) {
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("%q isn't an s3://bucket/prefix URL", bucketURL)
+	}
+
+	key, err := template.New("key").Option("missingkey=error").Parse(keyTemplate)
+	if err == nil {
+		// fail on unknown fields now rather than at the first upload
+		err = key.Execute(io.Discard, KeyData{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key template: %w", err)
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &Bucket{
+		client: client,
+		name:   u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+		key:    key,
+	}, nil
+}
+
+// Put uploads the payload of the cluster and returns its key.
+func (b *Bucket) Put(ctx context.Context, clusterName string, data []byte, contentType string) (string, error) {
+	now := time.Now().UTC()
+	var key strings.Builder
+	if err := b.key.Execute(&key, KeyData{
+		ClusterName: clusterName,
+		Timestamp:   now.Format("20060102T150405Z"),
+		Date:        now.Format(time.DateOnly),
+	}); err != nil {
+		return "", fmt.Errorf("key template: %w", err)
+	}
+	objectKey := path.Join(b.prefix, key.String())
+
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(b.name),
+		Key:         aws.String(objectKey),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return objectKey, nil
+}
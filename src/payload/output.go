@@ -0,0 +1,46 @@
+package payload
+
+import (
+	"encoding/json"
+	"io"
+	"keepup-helm-scraper/src/scraper"
+)
+
+// MarshalReport encodes the report as JSON indented with indent, compact
+// when it's empty.
+func MarshalReport(report scraper.ClusterInfo, indent string) ([]byte, error) {
+	if indent == "" {
+		return json.Marshal(report)
+	}
+	return json.MarshalIndent(report, "", indent)
+}
+
+// chartLine is a line of the ndjson output, a detection with its cluster.
+type chartLine struct {
+	ClusterName string `json:"cluster_name"`
+	KubeVersion string `json:"kube_version"`
+	scraper.HelmChartInfo
+}
+
+// WriteReport writes the report as JSON indented with indent, compact
+// when it's empty, or with ndjson as one line per detection carrying the
+// cluster name and Kubernetes version.
+func WriteReport(w io.Writer, report scraper.ClusterInfo, ndjson bool, indent string) error {
+	if !ndjson {
+		data, err := MarshalReport(report, indent)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, c := range report.HelmCharts {
+		line := chartLine{ClusterName: report.ClusterName, KubeVersion: report.KubeVersion, HelmChartInfo: c}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
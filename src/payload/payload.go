@@ -0,0 +1,93 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// Encoder renders the report into the request body.
+type Encoder struct {
+	tmpl *template.Template
+	// JSON keys renamed, from -> to
+	fieldMap map[string]string
+}
+
+// NewEncoder returns an encoder rendering the Go text/template file, or
+// marshaling to compact JSON when the path is empty, with the keys of
+// fieldMap renamed to its values. The template gets the report as its data
+// and a json function to marshal any value.
+func NewEncoder(templatePath string, fieldMap map[string]string) (*Encoder, error) {
+	if templatePath == "" {
+		return &Encoder{fieldMap: fieldMap}, nil
+	}
+
+	text, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(filepath.Base(templatePath)).
+		Funcs(template.FuncMap{"json": toJSON}).
+		Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{tmpl: tmpl}, nil
+}
+
+func (e *Encoder) Encode(report any) ([]byte, error) {
+	if e.tmpl == nil {
+		data, err := json.Marshal(report)
+		if err != nil || len(e.fieldMap) == 0 {
+			return data, err
+		}
+		return renameFields(data, e.fieldMap)
+	}
+
+	var buf bytes.Buffer
+	if err := e.tmpl.Execute(&buf, report); err != nil {
+		return nil, fmt.Errorf("failed to render payload template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renameFields renames the keys of the JSON objects in data at any depth,
+// f/e chart_name of every detection, as of fieldMap.
+func renameFields(data []byte, fieldMap map[string]string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// keeps large counts exact instead of going through float64
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(rename(v, fieldMap))
+}
+
+func rename(v any, fieldMap map[string]string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		renamed := make(map[string]any, len(v))
+		for k, item := range v {
+			if to, ok := fieldMap[k]; ok {
+				k = to
+			}
+			renamed[k] = rename(item, fieldMap)
+		}
+		return renamed
+	case []any:
+		for i, item := range v {
+			v[i] = rename(item, fieldMap)
+		}
+	}
+	return v
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
@@ -0,0 +1,36 @@
+package payload
+
+import (
+	"keepup-helm-scraper/src/inventorypb"
+	"keepup-helm-scraper/src/scraper"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// EncodeProto encodes the report as the inventorypb.ClusterInfo sent with
+// API_TRANSPORT=grpc. It carries the cluster and its detections, the
+// optional parts of the JSON payload like nodes or errors are left out.
+func EncodeProto(report scraper.ClusterInfo) ([]byte, error) {
+	msg := &inventorypb.ClusterInfo{
+		SchemaVersion: report.SchemaVersion,
+		ClusterName:   report.ClusterName,
+		KubeVersion:   report.KubeVersion,
+		Labels:        report.Labels,
+	}
+	for _, c := range report.HelmCharts {
+		msg.HelmCharts = append(msg.HelmCharts, &inventorypb.HelmChartInfo{
+			ChartName:      c.ChartName,
+			Category:       c.Category,
+			Version:        c.Version,
+			Namespace:      c.Namespace,
+			Source:         c.Source,
+			Registry:       c.Registry,
+			Repository:     c.Repository,
+			Sidecar:        c.Sidecar,
+			Count:          c.Count,
+			ContainerRoles: c.ContainerRoles,
+		})
+	}
+	// deterministic, so the idempotency key of a report doesn't change
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
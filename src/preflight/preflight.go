@@ -0,0 +1,74 @@
+// Package preflight checks that the scraper can run before it's scheduled:
+// RBAC permissions, configuration and reachability of the ingestion API.
+package preflight
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Check is the outcome of a single check, Err is nil when it passed.
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Access checks with SelfSubjectAccessReviews whether the scraper's
+// credentials allow each of the resource attributes.
+func Access(ctx context.Context, client kubernetes.Interface, attrs []authorizationv1.ResourceAttributes) []Check {
+	var checks []Check
+	for _, a := range attrs {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &a},
+		}
+		check := Check{Name: "can " + describe(a)}
+
+		result, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		switch {
+		case err != nil:
+			check.Err = err
+		case !result.Status.Allowed:
+			check.Err = fmt.Errorf("denied %s", result.Status.Reason)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// describe formats the attributes like kubectl auth can-i.
+func describe(a authorizationv1.ResourceAttributes) string {
+	resource := a.Resource
+	if a.Group != "" {
+		resource += "." + a.Group
+	}
+	if a.Name != "" {
+		resource += "/" + a.Name
+	}
+
+	scope := "in all namespaces"
+	if a.Namespace != "" {
+		scope = "in namespace " + a.Namespace
+	}
+	return strings.Join([]string{a.Verb, resource, scope}, " ")
+}
+
+// Print writes a pass/fail line per check and returns the number of failed ones.
+func Print(w io.Writer, checks []Check) int {
+	failed := 0
+	for _, c := range checks {
+		if c.Err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.Name, c.Err)
+		} else {
+			fmt.Fprintf(w, "PASS %s\n", c.Name)
+		}
+	}
+	fmt.Fprintf(w, "%d checks, %d failed\n", len(checks), failed)
+	return failed
+}
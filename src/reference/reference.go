@@ -0,0 +1,112 @@
+package reference
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Reference is a container image reference split into its parts.
+// Registry is empty when the image doesn't name one explicitly.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// Parse splits an image reference such as registry.internal:5000/team/app:1.2.3@sha256:...
+// The first path component is treated as a registry host only when it looks like one
+// (contains a dot or a port, or is localhost), following the docker reference rules.
+func Parse(image string) Reference {
+	var ref Reference
+
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+
+	if i := strings.Index(name, "/"); i >= 0 {
+		host := name[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			ref.Registry = host
+			name = name[i+1:]
+		}
+	}
+
+	// the tag separator is the last colon after the last slash,
+	// registry ports were already cut off above
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	ref.Repository = name
+
+	return ref
+}
+
+const (
+	defaultRegistry  = "docker.io"
+	officialRepoPath = "library/"
+)
+
+// Normalized fills in what the reference leaves implicit the way docker does:
+// nginx:1.25 is docker.io/library/nginx:1.25.
+func (r Reference) Normalized() Reference {
+	if r.Registry == "" {
+		r.Registry = defaultRegistry
+	}
+	if r.Registry == defaultRegistry && !strings.Contains(r.Repository, "/") {
+		r.Repository = officialRepoPath + r.Repository
+	}
+	return r
+}
+
+// Path returns the reference without the registry host: repository[:tag][@digest].
+func (r Reference) Path() string {
+	path := r.Repository
+	if r.Tag != "" {
+		path += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		path += "@" + r.Digest
+	}
+	return path
+}
+
+// the docker reference grammar, per part
+var (
+	domainRegex = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	pathRegex   = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRegex    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[A-Fa-f0-9]{32,}$`)
+)
+
+// Validate checks the image reference against the docker reference grammar,
+// naming the part that's malformed, f/e the repository nginx: of nginx::1.25.
+func Validate(image string) error {
+	switch {
+	case image == "":
+		return errors.New("empty reference")
+	case strings.IndexFunc(image, unicode.IsSpace) >= 0:
+		return errors.New("contains whitespace")
+	}
+
+	ref := Parse(image)
+	switch {
+	case ref.Registry != "" && !domainRegex.MatchString(ref.Registry):
+		return fmt.Errorf("invalid registry %q", ref.Registry)
+	case !pathRegex.MatchString(ref.Repository):
+		return fmt.Errorf("invalid repository %q", ref.Repository)
+	case strings.HasSuffix(strings.SplitN(image, "@", 2)[0], ":"):
+		return errors.New("empty tag")
+	case ref.Tag != "" && !tagRegex.MatchString(ref.Tag):
+		return fmt.Errorf("invalid tag %q", ref.Tag)
+	case strings.Contains(image, "@") && !digestRegex.MatchString(ref.Digest):
+		return fmt.Errorf("invalid digest %q", ref.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package reference
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		image   string
+		wantErr string
+	}{
+		{"nginx", ""},
+		{"nginx:1.25", ""},
+		{"registry.internal:5000/team/app:1.2.3", ""},
+		{"localhost/app@" + digest, ""},
+		{"ghcr.io/org/app:v1.2.3-rc.1@" + digest, ""},
+		{"", "empty reference"},
+		{"nginx :1.25", "contains whitespace"},
+		{"nginx:1.25\n", "contains whitespace"},
+		{"-registry.io/nginx:1.25", `invalid registry "-registry.io"`},
+		{"registry.io:port/nginx", `invalid registry "registry.io:port"`},
+		{"nginx::1.25", `invalid repository "nginx:"`},
+		{"Nginx:1.25", `invalid repository "Nginx"`},
+		{"team//app:1.0", `invalid repository "team//app"`},
+		{"registry.io/", `invalid repository ""`},
+		{"nginx:", "empty tag"},
+		{"nginx:-1.25", `invalid tag "-1.25"`},
+		{"nginx:1.25+build", `invalid tag "1.25+build"`},
+		{"nginx@sha256:abc", `invalid digest "sha256:abc"`},
+		{"nginx@", `invalid digest ""`},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.image)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.wantErr {
+			t.Errorf("Validate(%q) = %q, want %q", tt.image, got, tt.wantErr)
+		}
+	}
+}
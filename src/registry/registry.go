@@ -0,0 +1,313 @@
+// Package registry reads the labels of container images from their registry
+// over the registry HTTP API v2, f/e org.opencontainers.image.version of an
+// image tagged with a git sha.
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"keepup-helm-scraper/src/reference"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifest media types accepted, image indexes included
+var manifestTypes = strings.Join([]string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}, ", ")
+
+// the host serving the API of images on docker.io
+const dockerHubHost = "registry-1.docker.io"
+
+// Auth is the basic auth of a registry, f/e from a pull secret.
+type Auth struct {
+	Username string
+	Password string
+}
+
+// Credentials are the auths of registry hosts, f/e docker.io or ghcr.io.
+type Credentials map[string]Auth
+
+// Client reads image labels, caching them by manifest digest.
+type Client struct {
+	http      *http.Client
+	userAgent string
+
+	mu     sync.Mutex
+	labels map[string]map[string]string
+}
+
+func NewClient(userAgent string) *Client {
+	return &Client{
+		http:      &http.Client{Timeout: 30 * time.Second},
+		userAgent: userAgent,
+		labels:    make(map[string]map[string]string),
+	}
+}
+
+// manifest is an image manifest or, with Manifests, an image index.
+type manifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// Labels returns the labels of the image config. Of a multi-platform image
+// the linux/amd64 image is read, else the first one.
+func (c *Client) Labels(ctx context.Context, image string, creds Credentials) (map[string]string, error) {
+	ref := reference.Parse(image).Normalized()
+	if labels, ok := c.cached(ref.Digest); ok {
+		return labels, nil
+	}
+
+	s := &session{client: c, ctx: ctx, host: ref.Registry, repository: ref.Repository, auth: creds[ref.Registry]}
+	if s.host == "docker.io" {
+		s.host = dockerHubHost
+	}
+
+	tag := ref.Digest
+	if tag == "" {
+		tag = ref.Tag
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+
+	m, digest, err := s.manifest(tag)
+	if err != nil {
+		return nil, err
+	}
+	if labels, ok := c.cached(digest); ok {
+		return labels, nil
+	}
+	if len(m.Manifests) > 0 {
+		platform := m.Manifests[0].Digest
+		for _, p := range m.Manifests {
+			if p.Platform.OS == "linux" && p.Platform.Architecture == "amd64" {
+				platform = p.Digest
+				break
+			}
+		}
+		if m, _, err = s.manifest(platform); err != nil {
+			return nil, err
+		}
+	}
+
+	body, err := s.get("blobs/"+m.Config.Digest, "")
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil, fmt.Errorf("image config of %s: %w", image, err)
+	}
+
+	c.mu.Lock()
+	c.labels[digest] = config.Config.Labels
+	c.mu.Unlock()
+	return config.Config.Labels, nil
+}
+
+func (c *Client) cached(digest string) (map[string]string, bool) {
+	if digest == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	labels, ok := c.labels[digest]
+	return labels, ok
+}
+
+// session holds the token of the requests for a single repository.
+type session struct {
+	client     *Client
+	ctx        context.Context
+	host       string
+	repository string
+	auth       Auth
+	token      string
+}
+
+// manifest fetches the manifest of the tag or digest with its digest.
+func (s *session) manifest(tag string) (manifest, string, error) {
+	var m manifest
+	body, err := s.get("manifests/"+tag, manifestTypes)
+	if err != nil {
+		return m, "", err
+	}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return m, "", fmt.Errorf("manifest of %s/%s:%s: %w", s.host, s.repository, tag, err)
+	}
+	sum := sha256.Sum256(body)
+	return m, "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// get requests the repository path, authenticating as the registry
+// challenges to: with a bearer token or basic auth.
+func (s *session) get(path, accept string) ([]byte, error) {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", s.host, s.repository, path)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", s.client.userAgent)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		switch {
+		case s.token != "":
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		case s.auth != Auth{} && attempt > 0:
+			req.SetBasicAuth(s.auth.Username, s.auth.Password)
+		}
+
+		resp, err := s.client.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			if err := s.authenticate(resp.Header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s failed with status: %d", u, resp.StatusCode)
+		}
+		return body, nil
+	}
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authenticate answers the challenge of a 401 response, fetching a token
+// for Bearer; Basic is answered with the auth on the next attempt.
+func (s *session) authenticate(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return nil
+	}
+
+	query := url.Values{}
+	var realm string
+	for _, m := range challengeParam.FindAllStringSubmatch(params, -1) {
+		if m[1] == "realm" {
+			realm = m[2]
+		} else {
+			query.Set(m[1], m[2])
+		}
+	}
+	if realm == "" {
+		return fmt.Errorf("registry %s sent no token realm", s.host)
+	}
+	if query.Get("scope") == "" {
+		query.Set("scope", "repository:"+s.repository+":pull")
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", s.client.userAgent)
+	if s.auth != (Auth{}) {
+		req.SetBasicAuth(s.auth.Username, s.auth.Password)
+	}
+
+	resp, err := s.client.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token request to %s failed with status: %d", realm, resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("token of %s: %w", realm, err)
+	}
+	s.token = token.Token
+	if s.token == "" {
+		s.token = token.AccessToken
+	}
+	return nil
+}
+
+// ParseDockerConfig returns the credentials of a pull secret's
+// .dockerconfigjson, or of a legacy .dockercfg holding the auths only.
+func ParseDockerConfig(data []byte) (Credentials, error) {
+	type entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	var config struct {
+		Auths map[string]entry `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if config.Auths == nil {
+		if err := json.Unmarshal(data, &config.Auths); err != nil {
+			return nil, err
+		}
+	}
+
+	creds := make(Credentials)
+	for server, e := range config.Auths {
+		if e.Auth != "" {
+			if decoded, err := base64.StdEncoding.DecodeString(e.Auth); err == nil {
+				e.Username, e.Password, _ = strings.Cut(string(decoded), ":")
+			}
+		}
+		creds[registryHost(server)] = Auth{Username: e.Username, Password: e.Password}
+	}
+	return creds, nil
+}
+
+// registryHost returns the host of a docker config server key, which may be
+// a URL like https://index.docker.io/v1/.
+func registryHost(server string) string {
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if host == "index.docker.io" || host == dockerHubHost {
+		return "docker.io"
+	}
+	return host
+}
@@ -0,0 +1,105 @@
+// Package resolver runs an external command printing the version of an image,
+// for version schemes no rule can make sense of, f/e a build number mapped to
+// a release by a lookup table.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// a command still running after this long is killed
+	timeout = 10 * time.Second
+	// bytes of stdout kept, a longer output fails the command
+	maxOutput = 256
+	// bytes of stderr kept for the error
+	maxStderr = 1024
+)
+
+// Command is a command run with the image reference as its last argument,
+// printing the version of the image on stdout, nothing when it doesn't know it.
+//
+// It's run without a shell, in the temp dir, with no stdin and an environment
+// of PATH only, so the secrets of the scraper aren't passed on, and killed
+// once timeout passes.
+type Command struct {
+	path string
+	args []string
+}
+
+// New parses the command line, split on whitespace without shell quoting,
+// and looks its executable up in PATH.
+func New(commandLine string) (*Command, error) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return nil, errors.New("empty command")
+	}
+	path, err := exec.LookPath(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	return &Command{path: path, args: fields[1:]}, nil
+}
+
+// Resolve runs the command for the image and returns the trimmed line it
+// printed, empty when it printed nothing.
+func (c *Command) Resolve(ctx context.Context, image string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr cappedBuffer
+	stdout.max, stderr.max = maxOutput, maxStderr
+
+	cmd := exec.CommandContext(ctx, c.path, append(c.args, image)...)
+	cmd.Dir = os.TempDir()
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// don't wait on children holding the pipes after the command was killed
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("no version after %s", timeout)
+		}
+		if msg := strings.TrimSpace(string(stderr.buf)); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	if stdout.truncated {
+		return "", fmt.Errorf("output longer than %d bytes", maxOutput)
+	}
+
+	version := strings.TrimSpace(string(stdout.buf))
+	if i := strings.IndexFunc(version, func(r rune) bool {
+		return unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}); i >= 0 {
+		return "", fmt.Errorf("output %q isn't a single version", version)
+	}
+	return version, nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and drops the rest,
+// so a chatty command neither grows memory nor blocks on a full pipe.
+type cappedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := min(len(p), b.max-len(b.buf))
+	b.buf = append(b.buf, p[:n]...)
+	if n < len(p) {
+		b.truncated = true
+	}
+	return len(p), nil
+}
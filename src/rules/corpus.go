@@ -0,0 +1,33 @@
+package rules
+
+import (
+	"os"
+
+	"go.yaml.in/yaml/v2"
+)
+
+// CorpusEntry is an image with the detection it is expected to produce.
+// An empty Application expects no rule to match, an empty Version expects
+// a match without a version.
+type CorpusEntry struct {
+	Image       string `yaml:"image"`
+	Application string `yaml:"application"`
+	Version     string `yaml:"version"`
+}
+
+type CorpusFile struct {
+	Images []CorpusEntry `yaml:"images"`
+}
+
+func LoadCorpus(path string) ([]CorpusEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cf CorpusFile
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		return nil, err
+	}
+	return cf.Images, nil
+}
@@ -0,0 +1,52 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrRulesFileNotFound = errors.New("rules file not found")
+	ErrNoRules           = errors.New("rules file has no rules")
+)
+
+// RuleCompileError is a pattern of the rules file that can't be used.
+// Index is the position of the rule in the file, -1 for file-level patterns.
+// File is only set when several rules files are loaded.
+type RuleCompileError struct {
+	File            string
+	Index           int
+	ApplicationName string
+	Field           string
+	Pattern         string
+	Err             error
+}
+
+func (e *RuleCompileError) Error() string {
+	var msg string
+	if e.Index < 0 {
+		msg = fmt.Sprintf("invalid %s %q: %v", e.Field, e.Pattern, e.Err)
+	} else {
+		msg = fmt.Sprintf("invalid %s %q of rule #%d (%s): %v", e.Field, e.Pattern, e.Index+1, e.ApplicationName, e.Err)
+	}
+	if e.File != "" {
+		msg = e.File + ": " + msg
+	}
+	return msg
+}
+
+func (e *RuleCompileError) Unwrap() error {
+	return e.Err
+}
+
+// VersionError is a rules file without the supported version.
+type VersionError struct {
+	Version string
+}
+
+func (e *VersionError) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("rules file has no version, expected version: %q", FileVersion)
+	}
+	return fmt.Sprintf("unsupported rules file version %q, expected %q", e.Version, FileVersion)
+}
@@ -0,0 +1,97 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type HelmRuleYaml struct {
+	ApplicationName string `yaml:"applicationName"`
+	ChartRegex      string `yaml:"chartRegex"`
+	// optional, the chart version is reported as is without it
+	VersionRegex string `yaml:"versionRegex"`
+}
+
+// HelmRule maps Helm releases of matching charts to an application name.
+type HelmRule struct {
+	ApplicationName string
+	ChartRegex      *regexp.Regexp
+	// VersionRegex is nil unless the rule sets versionRegex
+	VersionRegex   *regexp.Regexp
+	NormalizeRegex *regexp.Regexp
+}
+
+// LoadHelmRules reads and compiles the helm sections of the rules files,
+// which may be empty, patched with the ones of overlayPath like LoadRules does.
+// Errors are like the ones of LoadRules, without ErrNoRules.
+func LoadHelmRules(path, overlayPath string) ([]HelmRule, error) {
+	rules, err := loadHelmRules(path)
+	if err != nil || overlayPath == "" {
+		return rules, err
+	}
+	overlayRules, err := loadHelmRules(overlayPath)
+	if err != nil {
+		return nil, fmt.Errorf("overlay: %w", err)
+	}
+	return overlay(rules, overlayRules, func(r HelmRule) string { return r.ApplicationName }), nil
+}
+
+// loadHelmRules compiles the helm rules of the rules files of path.
+func loadHelmRules(path string) ([]HelmRule, error) {
+	files, err := readConfigFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []HelmRule
+	for _, f := range files {
+		fileRules, err := compileHelmRules(f.DetectionConfigFile)
+		if err != nil {
+			return nil, f.wrap(err, len(files))
+		}
+		rules = append(rules, fileRules...)
+	}
+	return rules, nil
+}
+
+// compileHelmRules compiles the helm rules of a single rules file.
+func compileHelmRules(rf DetectionConfigFile) ([]HelmRule, error) {
+	normalizeRe, err := compileNormalizeRegex(rf.DefaultVersionRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []HelmRule
+	for i, r := range rf.HelmCharts {
+		compileError := func(field, pattern string, err error) error {
+			return &RuleCompileError{
+				Index:           i,
+				ApplicationName: r.ApplicationName,
+				Field:           "helm " + field,
+				Pattern:         pattern,
+				Err:             err,
+			}
+		}
+
+		chartRe, err := regexp.Compile(r.ChartRegex)
+		if err != nil {
+			return nil, compileError("chartRegex", r.ChartRegex, err)
+		}
+
+		var versionRe *regexp.Regexp
+		if r.VersionRegex != "" {
+			versionRe, err = regexp.Compile(r.VersionRegex)
+			if err != nil {
+				return nil, compileError("versionRegex", r.VersionRegex, err)
+			}
+		}
+
+		rules = append(rules, HelmRule{
+			ApplicationName: r.ApplicationName,
+			ChartRegex:      chartRe,
+			VersionRegex:    versionRe,
+			NormalizeRegex:  normalizeRe,
+		})
+	}
+	return rules, nil
+}
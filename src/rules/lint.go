@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// Severities of lint issues; only errors fail a lint.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue is a problem of a rule found by Lint.
+type LintIssue struct {
+	Severity        string
+	ApplicationName string
+	Message         string
+}
+
+// lintProbe is an image reference no sensible rule matches, a rule
+// matching it and the empty string matches any image.
+const lintProbe = "lint.invalid/probe:0"
+
+// Lint checks compiled rules for mistakes LoadRules accepts: rules matching
+// any image, duplicated rules of an application and, as warnings, rules
+// matching what a rule of another application looks for, which reports
+// such images twice. The overlap check is a heuristic, trying the shortest
+// text each detectionRegex matches against the rules of the other
+// applications.
+func Lint(rules []Rule) []LintIssue {
+	var issues []LintIssue
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		pattern := r.DetectionRegex.String()
+		if matchesAnyImage(r) {
+			issues = append(issues, LintIssue{
+				Severity:        LintError,
+				ApplicationName: r.ApplicationName,
+				Message:         fmt.Sprintf("detectionRegex '%s' matches any image", pattern),
+			})
+			continue
+		}
+
+		key := r.ApplicationName + "\x00" + pattern
+		if seen[key] {
+			issues = append(issues, LintIssue{
+				Severity:        LintError,
+				ApplicationName: r.ApplicationName,
+				Message:         fmt.Sprintf("detectionRegex '%s' is repeated", pattern),
+			})
+			continue
+		}
+		seen[key] = true
+
+		sample, ok := shortestMatch(pattern)
+		if !ok || !r.DetectionRegex.MatchString(sample) {
+			continue
+		}
+		for _, other := range rules {
+			// reported above already
+			if other.ApplicationName == r.ApplicationName || matchesAnyImage(other) {
+				continue
+			}
+			message := fmt.Sprintf("images matching '%s' are matched by '%s' of %s too",
+				pattern, other.DetectionRegex.String(), other.ApplicationName)
+			if !other.DetectionRegex.MatchString(sample) || seen[message] {
+				continue
+			}
+			seen[message] = true
+			issues = append(issues, LintIssue{
+				Severity:        LintWarning,
+				ApplicationName: r.ApplicationName,
+				Message:         message,
+			})
+		}
+	}
+	return issues
+}
+
+func matchesAnyImage(r Rule) bool {
+	return r.DetectionRegex.MatchString("") && r.DetectionRegex.MatchString(lintProbe)
+}
+
+// shortestMatch returns a short text the pattern matches, taking the first
+// branch of alternations and the fewest repetitions, f/e "nginx:" of
+// (\/)?nginx:; false for patterns it can't make one of.
+func shortestMatch(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	ok := writeShortest(&b, re.Simplify())
+	return b.String(), ok
+}
+
+func writeShortest(b *strings.Builder, re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return false
+		}
+		b.WriteRune(re.Rune[0])
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte('a')
+	case syntax.OpCapture, syntax.OpPlus:
+		return writeShortest(b, re.Sub[0])
+	case syntax.OpRepeat:
+		for range re.Min {
+			if !writeShortest(b, re.Sub[0]) {
+				return false
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !writeShortest(b, sub) {
+				return false
+			}
+		}
+	case syntax.OpAlternate:
+		return writeShortest(b, re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest, syntax.OpEmptyMatch,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+	default:
+		return false
+	}
+	return true
+}
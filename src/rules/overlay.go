@@ -0,0 +1,40 @@
+package rules
+
+import "log"
+
+// overlay replaces the base rules of every application the overlay has rules
+// for with the overlay's ones, in place of the first base rule, and appends
+// the overlay rules of applications the base has no rules for.
+func overlay[R any](base, overlayRules []R, application func(R) string) []R {
+	byApplication := make(map[string][]R)
+	var added []string
+	for _, r := range overlayRules {
+		name := application(r)
+		if _, ok := byApplication[name]; !ok {
+			added = append(added, name)
+		}
+		byApplication[name] = append(byApplication[name], r)
+	}
+
+	var merged []R
+	replaced := make(map[string]bool)
+	for _, r := range base {
+		name := application(r)
+		patched, ok := byApplication[name]
+		if !ok {
+			merged = append(merged, r)
+			continue
+		}
+		if !replaced[name] {
+			replaced[name] = true
+			log.Printf("Overlay replaces the rules of %s", name)
+			merged = append(merged, patched...)
+		}
+	}
+	for _, name := range added {
+		if !replaced[name] {
+			merged = append(merged, byApplication[name]...)
+		}
+	}
+	return merged
+}
@@ -1,27 +1,202 @@
 package rules
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"go.yaml.in/yaml/v2"
 )
 
 type DetectionRuleYaml struct {
 	ApplicationName string `yaml:"applicationName"`
+	// optional group of the application, f/e databases or ingress
+	Category        string `yaml:"category"`
 	VersionRegex    string `yaml:"versionRegex"`
+	VersionRegexRef string `yaml:"versionRegexRef"`
 	DetectionRegex  string `yaml:"detectionRegex"`
+	// pod template annotation holding the version when the tag has none
+	VersionAnnotation string `yaml:"versionAnnotation"`
+	// image label holding the version when neither the tag nor the annotation
+	// has one, f/e org.opencontainers.image.version; needs RESOLVE_IMAGE_LABELS
+	VersionLabel string `yaml:"versionLabel"`
+	// regex extracting the version out of the command and args of init
+	// containers running the image, f/e of a shared migration runner
+	ArgRegex string `yaml:"argRegex"`
+	// only match images running in containers of this role, see ContainerRole*
+	ContainerRole string `yaml:"containerRole"`
+	// report the images running in containers of these roles as components
+	// of the application named after the role, f/e init: migrator reports
+	// myapp/migrator, so init and main containers at different versions surface
+	RoleComponents map[string]string `yaml:"roleComponents"`
+	// only match images of workloads running on nodes of this OS, see OS*
+	OS string `yaml:"os"`
+	// only report versions below minVersion, or at or above it with
+	// minVersionMode above, see MinVersionMode*
+	MinVersion     string `yaml:"minVersion"`
+	MinVersionMode string `yaml:"minVersionMode"`
+	// how the matched version is normalized, see VersionType*
+	VersionType string `yaml:"versionType"`
+	// the highest confidence of the rule's detections, see Confidence*;
+	// high by default, lower it for rules prone to false positives
+	Confidence string `yaml:"confidence"`
 }
 
+// Types of the versions a rule matches: semver is normalized with the
+// defaultVersionRegex, calver as year.month.micro and raw reported as matched,
+// f/e a channel like stable.
+const (
+	VersionTypeSemVer = "semver"
+	VersionTypeCalVer = "calver"
+	VersionTypeRaw    = "raw"
+)
+
+// calVerRegex matches YYYY.MM[.micro] or YY.MM[.micro], also with dashes.
+var calVerRegex = regexp.MustCompile(`(\d{4}|\d{2})[.-](\d{1,2})([.-](\d+))?`)
+
+// Roles of the containers running an image. Ephemeral containers have
+// none, Kubernetes only adds them to running pods, never to the pod
+// templates the images are collected from.
+const (
+	ContainerRoleMain = "main"
+	ContainerRoleInit = "init"
+)
+
+// OSes of the nodes a workload runs on, as of its spec.os or its
+// kubernetes.io/os node selector.
+const (
+	OSLinux   = "linux"
+	OSWindows = "windows"
+)
+
+// Confidences of detections, of where their version was found: high for
+// the image tag, medium for an annotation, an image label or the args of
+// init containers and low for the version resolver, capped by the rule's.
+const (
+	ConfidenceHigh   = "high"
+	ConfidenceMedium = "medium"
+	ConfidenceLow    = "low"
+)
+
+var confidenceRanks = map[string]int{ConfidenceLow: 1, ConfidenceMedium: 2, ConfidenceHigh: 3}
+
+// CompareConfidence compares confidences like cmp.Compare, low < medium < high.
+func CompareConfidence(a, b string) int {
+	return cmp.Compare(confidenceRanks[a], confidenceRanks[b])
+}
+
+// Modes of a rule's minVersion.
+const (
+	MinVersionModeBelow = "below"
+	MinVersionModeAbove = "above"
+)
+
+// DefaultVersionRegex normalizes versions when the rules file sets no
+// defaultVersionRegex. Its groups are major, minor and the optional .patch
+const DefaultVersionRegex = `(\d+)\.(\d+)(\.\d+)?`
+
+// FileVersion is the rules file schema this scraper reads. Files must set it
+// as version, so one written for a future schema isn't silently mis-parsed.
+const FileVersion = "1"
+
 type DetectionConfigFile struct {
+	Version string `yaml:"version"`
+	// DefaultVersionRegex extracts major, minor and .patch out of the string
+	// matched by a rule's versionRegex
+	DefaultVersionRegex string `yaml:"defaultVersionRegex"`
+	// Patterns are named regexes rules can refer to with versionRegexRef
+	Patterns     map[string]string   `yaml:"patterns"`
 	DockerImages []DetectionRuleYaml `yaml:"docker"`
+	HelmCharts   []HelmRuleYaml      `yaml:"helm"`
 }
 
+// Rule is a compiled detection rule. Its patterns are Go (RE2) regexes, which
+// match in time linear to the input and reject backreferences and lookarounds,
+// so no rule can backtrack catastrophically and a match needs no timeout.
 type Rule struct {
-	ApplicationName string
-	VersionRegex    *regexp.Regexp
-	DetectionRegex  *regexp.Regexp
+	ApplicationName   string
+	Category          string
+	VersionRegex      *regexp.Regexp
+	DetectionRegex    *regexp.Regexp
+	VersionAnnotation string
+	VersionLabel      string
+	// ArgRegex is nil unless the rule sets argRegex
+	ArgRegex      *regexp.Regexp
+	ContainerRole string
+	// RoleComponents names the components of the roles, nil unless the rule
+	// sets roleComponents
+	RoleComponents map[string]string
+	OS             string
+	// MinVersion is the normalized minVersion, empty unless the rule sets it
+	MinVersion     string
+	MinVersionMode string
+	VersionType    string
+	// Confidence is the rule's confidence, high unless it sets a lower one
+	Confidence string
+	// NormalizeRegex is the file's defaultVersionRegex
+	NormalizeRegex *regexp.Regexp
+}
+
+// Find returns what re matches in s, for raw versions its first group if
+// it has one, so f/e ':(\w+)$' reports the channel of the tag without the colon.
+func (r Rule) Find(re *regexp.Regexp, s string) string {
+	if r.VersionType == VersionTypeRaw && re.NumSubexp() > 0 {
+		if m := re.FindStringSubmatch(s); m != nil {
+			return m[1]
+		}
+		return ""
+	}
+	return re.FindString(s)
+}
+
+// Normalize returns the version in what the rule's versionRegex, argRegex
+// or versionAnnotation found, as of its versionType.
+func (r Rule) Normalize(matched string) (string, bool) {
+	switch r.VersionType {
+	case VersionTypeRaw:
+		return matched, matched != ""
+	case VersionTypeCalVer:
+		return NormalizeCalVer(matched)
+	default:
+		return NormalizeSemVer(matched, r.NormalizeRegex)
+	}
+}
+
+// KeepsVersion reports whether a detection with the normalized version is
+// reported by the rule's minVersion; unknown versions aren't when it's set.
+func (r Rule) KeepsVersion(version string, hasVersion bool) bool {
+	if r.MinVersion == "" {
+		return true
+	}
+	if !hasVersion {
+		return false
+	}
+	below := CompareVersions(version, r.MinVersion) < 0
+	return below == (r.MinVersionMode != MinVersionModeAbove)
+}
+
+// CompareVersions compares two normalized major.minor.patch versions
+// numerically, returning -1, 0 or +1.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if c := cmp.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
 }
 
 type DetectedComponent struct {
@@ -30,35 +205,375 @@ type DetectedComponent struct {
 	Version string
 }
 
-func LoadRules(path string) ([]Rule, error) {
-	data, err := os.ReadFile(path)
+// LoadRules reads and compiles the rules files of path, see readConfigFiles,
+// and patches them with the rules of overlayPath, if set: its rules replace
+// the ones of the same application and add new applications.
+// Errors are ErrRulesFileNotFound, ErrNoRules, a *RuleCompileError, a
+// *VersionError or YAML parse errors. Applications with rules in several files are logged.
+func LoadRules(path, overlayPath string) ([]Rule, error) {
+	rules, err := loadRules(path)
 	if err != nil {
 		return nil, err
 	}
+	if overlayPath != "" {
+		overlayRules, err := loadRules(overlayPath)
+		if err != nil {
+			return nil, fmt.Errorf("overlay: %w", err)
+		}
+		rules = overlay(rules, overlayRules, func(r Rule) string { return r.ApplicationName })
+	}
 
-	var rf DetectionConfigFile
-	if err := yaml.Unmarshal(data, &rf); err != nil {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoRules, path)
+	}
+	return rules, nil
+}
+
+// loadRules compiles the docker rules of the rules files of path.
+func loadRules(path string) ([]Rule, error) {
+	files, err := readConfigFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	fileByApplication := make(map[string]string)
+	for _, f := range files {
+		fileRules, err := compileRules(f.DetectionConfigFile)
+		if err != nil {
+			return nil, f.wrap(err, len(files))
+		}
+		for _, r := range fileRules {
+			if other, ok := fileByApplication[r.ApplicationName]; ok && other != f.path {
+				log.Printf("Application %s has rules in %s and %s", r.ApplicationName, other, f.path)
+			}
+			fileByApplication[r.ApplicationName] = f.path
+		}
+		rules = append(rules, fileRules...)
+	}
+	return rules, nil
+}
+
+// compileRules compiles the docker rules of a single rules file.
+func compileRules(rf DetectionConfigFile) ([]Rule, error) {
+	normalizeRe, err := compileNormalizeRegex(rf.DefaultVersionRegex)
+	if err != nil {
 		return nil, err
 	}
 
 	var rules []Rule
-	for _, r := range rf.DockerImages {
+	for i, r := range rf.DockerImages {
+		compileError := func(field, pattern string, err error) error {
+			return &RuleCompileError{
+				Index:           i,
+				ApplicationName: r.ApplicationName,
+				Field:           field,
+				Pattern:         pattern,
+				Err:             err,
+			}
+		}
+
 		detectRe, err := regexp.Compile(r.DetectionRegex)
 		if err != nil {
-			return nil, fmt.Errorf("invalid detection regex for %s: %w", r.ApplicationName, err)
+			return nil, compileError("detectionRegex", r.DetectionRegex, err)
 		}
 
-		versionRe, err := regexp.Compile(r.VersionRegex)
+		versionRegex, err := resolveVersionRegex(r, rf.Patterns)
 		if err != nil {
-			return nil, fmt.Errorf("invalid version regex for %s: %w", r.ApplicationName, err)
+			return nil, compileError("versionRegexRef", r.VersionRegexRef, err)
+		}
+
+		versionRe, err := regexp.Compile(versionRegex)
+		if err != nil {
+			return nil, compileError("versionRegex", versionRegex, err)
+		}
+
+		var argRe *regexp.Regexp
+		if r.ArgRegex != "" {
+			argRe, err = regexp.Compile(r.ArgRegex)
+			if err != nil {
+				return nil, compileError("argRegex", r.ArgRegex, err)
+			}
+		}
+
+		switch r.ContainerRole {
+		case "", ContainerRoleMain, ContainerRoleInit:
+		default:
+			return nil, compileError("containerRole", r.ContainerRole, errors.New("must be main or init"))
+		}
+
+		for role, component := range r.RoleComponents {
+			switch role {
+			case ContainerRoleMain, ContainerRoleInit:
+			default:
+				return nil, compileError("roleComponents", role, errors.New("must be main or init"))
+			}
+			if component == "" || strings.Contains(component, "/") {
+				return nil, compileError("roleComponents", component, errors.New("must be a name without /"))
+			}
+		}
+
+		switch r.OS {
+		case "", OSLinux, OSWindows:
+		default:
+			return nil, compileError("os", r.OS, errors.New("must be linux or windows"))
+		}
+
+		switch r.MinVersionMode {
+		case "", MinVersionModeBelow, MinVersionModeAbove:
+		default:
+			return nil, compileError("minVersionMode", r.MinVersionMode, errors.New("must be below or above"))
+		}
+
+		switch r.VersionType {
+		case "", VersionTypeSemVer, VersionTypeCalVer, VersionTypeRaw:
+		default:
+			return nil, compileError("versionType", r.VersionType, errors.New("must be semver, calver or raw"))
+		}
+
+		switch r.Confidence {
+		case "", ConfidenceHigh, ConfidenceMedium, ConfidenceLow:
+		default:
+			return nil, compileError("confidence", r.Confidence, errors.New("must be high, medium or low"))
 		}
 
-		rules = append(rules, Rule{
-			ApplicationName: r.ApplicationName,
-			DetectionRegex:  detectRe,
-			VersionRegex:    versionRe,
-		})
+		rule := Rule{
+			ApplicationName:   r.ApplicationName,
+			Category:          r.Category,
+			DetectionRegex:    detectRe,
+			VersionRegex:      versionRe,
+			VersionAnnotation: r.VersionAnnotation,
+			VersionLabel:      r.VersionLabel,
+			ArgRegex:          argRe,
+			ContainerRole:     r.ContainerRole,
+			RoleComponents:    r.RoleComponents,
+			OS:                r.OS,
+			MinVersionMode:    r.MinVersionMode,
+			VersionType:       r.VersionType,
+			Confidence:        cmp.Or(r.Confidence, ConfidenceHigh),
+			NormalizeRegex:    normalizeRe,
+		}
+
+		if r.MinVersion != "" {
+			if r.VersionType == VersionTypeRaw {
+				return nil, compileError("minVersion", r.MinVersion, errors.New("can't compare raw versions"))
+			}
+			var ok bool
+			rule.MinVersion, ok = rule.Normalize(r.MinVersion)
+			if !ok {
+				return nil, compileError("minVersion", r.MinVersion, errors.New("not a version"))
+			}
+		}
+
+		rules = append(rules, rule)
 	}
 
 	return rules, nil
 }
+
+// URLHeader is sent with requests for rules files given as http(s) URLs,
+// f/e to authenticate to the service serving them.
+var URLHeader = http.Header{}
+
+// rulesFile is a parsed rules file with its path.
+type rulesFile struct {
+	path string
+	DetectionConfigFile
+}
+
+// wrap adds the path to errors of one of several files.
+func (f rulesFile) wrap(err error, files int) error {
+	if files == 1 {
+		return err
+	}
+	var compileErr *RuleCompileError
+	if errors.As(err, &compileErr) {
+		compileErr.File = f.path
+		return err
+	}
+	return fmt.Errorf("%s: %w", f.path, err)
+}
+
+// readConfigFiles reads the rules files of path: a file, an http(s) URL,
+// a directory of .yaml/.yml files or a comma-separated list of those.
+func readConfigFiles(path string) ([]rulesFile, error) {
+	var files []rulesFile
+	for _, p := range strings.Split(path, ",") {
+		p = strings.TrimSpace(p)
+		paths := []string{p}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			paths = nil
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if ext := filepath.Ext(e.Name()); !e.IsDir() && (ext == ".yaml" || ext == ".yml") {
+					paths = append(paths, filepath.Join(p, e.Name()))
+				}
+			}
+		}
+
+		for _, filePath := range paths {
+			rf, err := readConfigFile(filePath)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, rulesFile{path: filePath, DetectionConfigFile: rf})
+		}
+	}
+	return files, nil
+}
+
+// readConfigFile reads the rules file from a path or an http(s) URL.
+func readConfigFile(path string) (DetectionConfigFile, error) {
+	var rf DetectionConfigFile
+
+	read := os.ReadFile
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		read = fetch
+	}
+
+	data, err := read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rf, fmt.Errorf("%w: %s", ErrRulesFileNotFound, path)
+	}
+	if err != nil {
+		return rf, err
+	}
+
+	// strict, so a misspelled key fails instead of leaving its field empty
+	if err := yaml.UnmarshalStrict(data, &rf); err != nil {
+		return rf, err
+	}
+	if rf.Version != FileVersion {
+		return rf, fmt.Errorf("%s: %w", path, &VersionError{Version: rf.Version})
+	}
+	return rf, nil
+}
+
+// fetch downloads the rules file, a 404 is reported as fs.ErrNotExist.
+func fetch(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = URLHeader.Clone()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fs.ErrNotExist
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetching rules failed with status: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func compileNormalizeRegex(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = DefaultVersionRegex
+	}
+	compileError := func(err error) error {
+		return &RuleCompileError{Index: -1, Field: "defaultVersionRegex", Pattern: pattern, Err: err}
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, compileError(err)
+	}
+	if re.NumSubexp() < 3 {
+		return nil, compileError(fmt.Errorf("needs groups for major, minor and patch, got %d", re.NumSubexp()))
+	}
+	return re, nil
+}
+
+// NormalizeSemVer extracts the first major.minor[.patch] of imageVer as a SemVer,
+// using the groups of versionRe. A missing patch defaults to .0 and anything
+// around the version is dropped, as is the 2019 of a Windows ltsc2019 tag.
+// With the default version regex:
+//
+//	1.2                 -> 1.2.0
+//	1.2.3, v1.2.3       -> 1.2.3
+//	nginx:1.25.1-alpine -> 1.25.1
+//	release1.2.3        -> 1.2.3
+//	2023.11             -> 2023.11.0
+//	ltsc2019.1-4.8      -> 4.8.0
+//	latest, ""          -> not a version (false)
+func NormalizeSemVer(imageVer string, versionRe *regexp.Regexp) (string, bool) {
+	m := findVersion(versionRe, imageVer)
+	if m == nil {
+		return "", false
+	}
+
+	major := m[1]
+	minor := m[2]
+	patch := m[3]
+
+	// set .0 as default patch version acc. to SemVer
+	if patch == "" {
+		patch = ".0"
+	}
+
+	return fmt.Sprintf("%s.%s%s", major, minor, patch), true
+}
+
+// NormalizeCalVer extracts the first calendar version of ver as
+// year.month.micro, without leading zeros and with a .0 micro by default:
+//
+//	2024.01.15 -> 2024.1.15
+//	24.04      -> 2024.4.0
+//	2023-11    -> 2023.11.0
+func NormalizeCalVer(ver string) (string, bool) {
+	m := findVersion(calVerRegex, ver)
+	if m == nil {
+		return "", false
+	}
+
+	year, _ := strconv.Atoi(m[1])
+	if len(m[1]) == 2 {
+		year += 2000
+	}
+	month, _ := strconv.Atoi(m[2])
+	micro, _ := strconv.Atoi(m[4])
+	return fmt.Sprintf("%d.%d.%d", year, month, micro), true
+}
+
+// findVersion returns the submatches of the first match of re in s whose
+// first group isn't glued to a Windows LTSC suffix, so the ltsc2019 of a
+// Windows tag isn't taken for a version while release1.2.3 still is.
+func findVersion(re *regexp.Regexp, s string) []string {
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		if start := loc[2]; start >= 0 && strings.HasSuffix(strings.ToLower(s[:start]), "ltsc") {
+			continue
+		}
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = s[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+func resolveVersionRegex(r DetectionRuleYaml, patterns map[string]string) (string, error) {
+	if r.VersionRegexRef == "" {
+		return r.VersionRegex, nil
+	}
+	if r.VersionRegex != "" {
+		return "", errors.New("versionRegex is set as well")
+	}
+	pattern, ok := patterns[r.VersionRegexRef]
+	if !ok {
+		return "", errors.New("no such pattern")
+	}
+	return pattern, nil
+}
@@ -0,0 +1,34 @@
+package rules
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNormalizeSemVer(t *testing.T) {
+	versionRe := regexp.MustCompile(DefaultVersionRegex)
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"1.2", "1.2.0", true},
+		{"1.2.3", "1.2.3", true},
+		{"v1.2.3", "1.2.3", true},
+		{"nginx:1.25.1-alpine", "1.25.1", true},
+		{"latest", "", false},
+		{"2023.11", "2023.11.0", true},
+		{"release1.2.3", "1.2.3", true},
+		{"build2.0.1", "2.0.1", true},
+		{"4.8-windowsservercore-ltsc2019", "4.8.0", true},
+		{"ltsc2019.1-4.8", "4.8.0", true},
+		{"nanoserver-ltsc2019.1", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeSemVer(tt.in, versionRe)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("NormalizeSemVer(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
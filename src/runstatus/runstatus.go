@@ -0,0 +1,97 @@
+// Package runstatus records the outcome of the last scrape in a ConfigMap,
+// so operators can check it with kubectl after the pod logs are gone, and
+// keeps the versions of REPORT_DOWNGRADES there over one-shot runs.
+package runstatus
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Results of a run.
+const (
+	ResultOK           = "ok"
+	ResultScrapeFailed = "scrape-failed"
+	// the report was scraped, but the API didn't take it
+	ResultSendFailed = "send-failed"
+)
+
+// Status is the outcome of a run.
+type Status struct {
+	Time    time.Time
+	Cluster string
+	Result  string
+	// Message is the error of a failed run
+	Message      string
+	Detections   int
+	ScrapeErrors int
+	Version      string
+}
+
+// versionsKey is the key of the ConfigMap holding the versions of WriteVersions.
+const versionsKey = "versions"
+
+// Write records the status in the ConfigMap, creating it when missing.
+func Write(ctx context.Context, client kubernetes.Interface, namespace, name string, status Status) error {
+	return update(ctx, client, namespace, name, map[string]string{
+		"last_run":      status.Time.UTC().Format(time.RFC3339),
+		"cluster":       status.Cluster,
+		"result":        status.Result,
+		"message":       status.Message,
+		"detections":    strconv.Itoa(status.Detections),
+		"scrape_errors": strconv.Itoa(status.ScrapeErrors),
+		"version":       status.Version,
+	})
+}
+
+// ReadVersions returns the versions WriteVersions kept in the ConfigMap,
+// nil when there are none yet.
+func ReadVersions(ctx context.Context, client kubernetes.Interface, namespace, name string) ([]byte, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if versions, ok := cm.Data[versionsKey]; ok {
+		return []byte(versions), nil
+	}
+	return nil, nil
+}
+
+// WriteVersions keeps the versions in the ConfigMap next to the status,
+// creating it when missing.
+func WriteVersions(ctx context.Context, client kubernetes.Interface, namespace, name string, versions []byte) error {
+	return update(ctx, client, namespace, name, map[string]string{versionsKey: string(versions)})
+}
+
+// update sets the keys of data in the ConfigMap, keeping its other keys,
+// and creates it when missing.
+func update(ctx context.Context, client kubernetes.Interface, namespace, name string, data map[string]string) error {
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	maps.Copy(cm.Data, data)
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
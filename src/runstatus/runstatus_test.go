@@ -0,0 +1,41 @@
+package runstatus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestVersionsKeptNextToStatus(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	versions, err := ReadVersions(ctx, client, "monitoring", "keepup-status")
+	if err != nil || versions != nil {
+		t.Fatalf("ReadVersions() of a missing ConfigMap = %q, %v; want nil, nil", versions, err)
+	}
+
+	kept := []byte(`[{"namespace":"shop","application":"nginx","source":"image","version":"1.25.3"}]`)
+	if err := WriteVersions(ctx, client, "monitoring", "keepup-status", kept); err != nil {
+		t.Fatal(err)
+	}
+	status := Status{Time: time.Now(), Cluster: "test", Result: ResultOK}
+	if err := Write(ctx, client, "monitoring", "keepup-status", status); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err = ReadVersions(ctx, client, "monitoring", "keepup-status")
+	if err != nil || string(versions) != string(kept) {
+		t.Errorf("ReadVersions() = %q, %v; want %q", versions, err, kept)
+	}
+	cm, err := client.CoreV1().ConfigMaps("monitoring").Get(ctx, "keepup-status", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["result"] != ResultOK || cm.Data["cluster"] != "test" {
+		t.Errorf("ConfigMap data = %v, want the status as well", cm.Data)
+	}
+}
@@ -0,0 +1,126 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// getClusterName takes the cluster name from the ConfigMap key in configMapRef,
+// the kubeadm ClusterConfiguration or the nodeLabel of a node, in that order.
+// It reports false when it falls back to the default.
+func getClusterName(ctx context.Context, client kubernetes.Interface, configMapRef, nodeLabel string) (string, bool) {
+	if configMapRef != "" {
+		name, err := clusterNameFromConfigMap(ctx, client, configMapRef)
+		if err == nil && name != "" {
+			log.Printf("Using cluster name from ConfigMap %s: %s", configMapRef, name)
+			return name, true
+		}
+		log.Printf("Cluster name not found in ConfigMap %s: %v", configMapRef, err)
+	}
+
+	if name, err := clusterNameFromKubeadm(ctx, client); err == nil && name != "" {
+		log.Printf("Using cluster name from kubeadm-config: %s", name)
+		return name, true
+	}
+
+	if nodeLabel != "" {
+		name, err := clusterNameFromNodeLabel(ctx, client, nodeLabel)
+		if err == nil && name != "" {
+			log.Printf("Using cluster name from node label %s: %s", nodeLabel, name)
+			return name, true
+		}
+		log.Printf("Cluster name not found in node label %s: %v", nodeLabel, err)
+	}
+
+	log.Println("Cluster name not found, using default 'minikube'")
+	return "minikube", false
+}
+
+// clusterNameFromConfigMap reads the key of a ConfigMap given as namespace/name/key.
+func clusterNameFromConfigMap(ctx context.Context, client kubernetes.Interface, ref string) (string, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("expected namespace/name/key, got %q", ref)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(cm.Data[parts[2]]), nil
+}
+
+// clusterNameFromKubeadm parses clusterName out of the ClusterConfiguration
+// YAML kubeadm keeps in kube-system/kubeadm-config.
+func clusterNameFromKubeadm(ctx context.Context, client kubernetes.Interface) (string, error) {
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(ctx, "kubeadm-config", metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	var clusterConfig struct {
+		ClusterName string `yaml:"clusterName"`
+	}
+	if err := yaml.Unmarshal([]byte(cm.Data["ClusterConfiguration"]), &clusterConfig); err != nil {
+		return "", err
+	}
+	return clusterConfig.ClusterName, nil
+}
+
+// clusterNameFromNodeLabel reads the label off any node carrying it, as managed
+// clusters label their nodes with the cluster name.
+func clusterNameFromNodeLabel(ctx context.Context, client kubernetes.Interface, label string) (string, error) {
+	// a label key alone selects the nodes having it
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: label, Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	if len(nodes.Items) == 0 {
+		return "", errors.New("no node has the label")
+	}
+	return strings.TrimSpace(nodes.Items[0].Labels[label]), nil
+}
+
+// getKubernetesVersion returns the formatted apiserver version, reporting
+// false when it falls back to unknown-version.
+func getKubernetesVersion(client kubernetes.Interface, format string) (string, bool) {
+	versionInfo, err := client.Discovery().ServerVersion()
+	if err != nil {
+		log.Println("Failed to fetch Kubernetes version, using 'unknown-version'")
+		return "unknown-version", false
+	}
+	return formatKubeVersion(versionInfo.GitVersion, format), true
+}
+
+// kubeVersionRegex matches the version in front of distro suffixes like
+// v1.29.2-eks-1234, v1.27.3-gke.100 or v1.28.5+rke2r1.
+var kubeVersionRegex = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)`)
+
+// formatKubeVersion formats the apiserver git version, keeping it as it is
+// when it doesn't start with a version:
+//
+//	raw:         v1.28.5+k3s1 -> v1.28.5+k3s1
+//	semver:      v1.28.5+k3s1 -> 1.28.5
+//	major-minor: v1.28.5+k3s1 -> 1.28
+func formatKubeVersion(gitVersion, format string) string {
+	m := kubeVersionRegex.FindStringSubmatch(gitVersion)
+	if m == nil {
+		return gitVersion
+	}
+	switch format {
+	case KubeVersionSemVer:
+		return m[1] + "." + m[2] + "." + m[3]
+	case KubeVersionMajorMinor:
+		return m[1] + "." + m[2]
+	default:
+		return gitVersion
+	}
+}
@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"keepup-helm-scraper/src/reference"
+	"keepup-helm-scraper/src/rules"
+	"log"
+	"slices"
+)
+
+// Detection is an application a rule detected in an image.
+type Detection struct {
+	ApplicationName string
+	// Component of the application the rule's roleComponents name for the
+	// role of the containers running the image, empty without
+	Component  string
+	Category   string
+	Version    string
+	HasVersion bool
+	// Confidence of the version, see rules.Confidence*
+	Confidence string
+}
+
+// Name is the reported name of the detection, application/component for
+// a component.
+func (d Detection) Name() string {
+	if d.Component == "" {
+		return d.ApplicationName
+	}
+	return d.ApplicationName + "/" + d.Component
+}
+
+// ImageContext is what is known about the workloads running an image.
+// The zero value stands for an image seen on its own, f/e by test-rule.
+type ImageContext struct {
+	// pod template annotations of the first workload running the image
+	Annotations map[string]string
+	// command lines of init containers running the image
+	InitCommands []string
+	// roles of the containers running the image, see rules.ContainerRole*
+	ContainerRoles []string
+	// OSes of the nodes the workloads running the image run on, see rules.OS*
+	OSes []string
+	// Labels returns the labels of the image from its registry, nil when
+	// they aren't read
+	Labels func() (map[string]string, error)
+	// ResolveVersion returns the version an external command prints for
+	// the image, empty when it doesn't know it; nil when there's none
+	ResolveVersion func() (string, error)
+}
+
+// DetectImage runs every rule against the image and returns one detection
+// per matched rule, in rules order. Versions are extracted from the reference
+// without its registry host, so a registry port is never taken for a tag.
+// When the tag has no version, a rule may take it from a pod template annotation
+// or else from a label of the image, read from its registry, and as a last
+// resort reports what the version resolver prints for the image as is.
+// A rule with an argRegex reports one detection per version found in the
+// command lines of init containers running the image, before looking at the tag.
+// A rule with a containerRole only matches images running in such containers,
+// one with an os only images of workloads running on nodes of that OS,
+// one with a minVersion drops the detections outside its range.
+// The confidence of a detection follows from where its version was found,
+// capped by the rule's. A rule with roleComponents reports a detection per
+// component of the roles of the containers running the image, the versions
+// of its argRegex as the component of init containers.
+func DetectImage(img string, ictx ImageContext, imageRules []rules.Rule) []Detection {
+	var detections []Detection
+	path := reference.Parse(img).Path()
+	for _, rule := range imageRules {
+		if !rule.DetectionRegex.MatchString(img) {
+			continue
+		}
+		if rule.ContainerRole != "" && ictx.ContainerRoles != nil && !slices.Contains(ictx.ContainerRoles, rule.ContainerRole) {
+			continue
+		}
+		if rule.OS != "" && ictx.OSes != nil && !slices.Contains(ictx.OSes, rule.OS) {
+			continue
+		}
+		if argDetections := detectArgs(rule, ictx.InitCommands); len(argDetections) > 0 {
+			for _, d := range argDetections {
+				if rule.KeepsVersion(d.Version, d.HasVersion) {
+					detections = append(detections, d)
+				}
+			}
+			continue
+		}
+		v, ok := rule.Normalize(rule.Find(rule.VersionRegex, path))
+		confidence := rules.ConfidenceHigh
+		if !ok && rule.VersionAnnotation != "" {
+			if annotated, found := ictx.Annotations[rule.VersionAnnotation]; found {
+				v, ok = rule.Normalize(annotated)
+				confidence = rules.ConfidenceMedium
+			}
+		}
+		if !ok && rule.VersionLabel != "" && ictx.Labels != nil {
+			labels, err := ictx.Labels()
+			if err != nil {
+				log.Printf("Can't read the labels of %s: %v", img, err)
+			} else if labeled, found := labels[rule.VersionLabel]; found {
+				v, ok = rule.Normalize(labeled)
+				confidence = rules.ConfidenceMedium
+			}
+		}
+		if !ok && ictx.ResolveVersion != nil {
+			resolved, err := ictx.ResolveVersion()
+			if err != nil {
+				log.Printf("Can't resolve the version of %s: %v", img, err)
+			} else if resolved != "" {
+				v, ok = resolved, true
+				confidence = rules.ConfidenceLow
+			}
+		}
+		if !rule.KeepsVersion(v, ok) {
+			continue
+		}
+		detections = append(detections, roleDetections(rule, Detection{
+			ApplicationName: rule.ApplicationName,
+			Category:        rule.Category,
+			Version:         v,
+			HasVersion:      ok,
+			Confidence:      capConfidence(rule, confidence),
+		}, ictx.ContainerRoles)...)
+	}
+	return detections
+}
+
+// roleDetections returns the detection once per component the rule names
+// for the roles, as it is for roles without one. Without roleComponents or
+// known roles, f/e for test-rule, it's returned as it is.
+func roleDetections(rule rules.Rule, d Detection, roles []string) []Detection {
+	if len(rule.RoleComponents) == 0 || len(roles) == 0 {
+		return []Detection{d}
+	}
+	var detections []Detection
+	for _, role := range roles {
+		component := d
+		component.Component = rule.RoleComponents[role]
+		if !slices.ContainsFunc(detections, func(c Detection) bool { return c.Component == component.Component }) {
+			detections = append(detections, component)
+		}
+	}
+	return detections
+}
+
+// capConfidence lowers the confidence to the rule's.
+func capConfidence(rule rules.Rule, confidence string) string {
+	if rule.Confidence != "" && rules.CompareConfidence(rule.Confidence, confidence) < 0 {
+		return rule.Confidence
+	}
+	return confidence
+}
+
+// DetectChart maps a Helm chart to the application name and version of the
+// first matching rule. The chart version is kept when the rule has no
+// versionRegex or it finds no version, the chart when no rule matches.
+func DetectChart(chart, chartVersion string, helmRules []rules.HelmRule) (string, string) {
+	for _, rule := range helmRules {
+		if !rule.ChartRegex.MatchString(chart) {
+			continue
+		}
+		if rule.VersionRegex == nil {
+			return rule.ApplicationName, chartVersion
+		}
+		v, ok := rules.NormalizeSemVer(rule.VersionRegex.FindString(chartVersion), rule.NormalizeRegex)
+		if !ok {
+			log.Printf("No version in chart %s %s, keeping it as is", chart, chartVersion)
+			v = chartVersion
+		}
+		return rule.ApplicationName, v
+	}
+	return chart, chartVersion
+}
+
+// detectArgs returns the versions the rule's argRegex finds in the command lines.
+func detectArgs(rule rules.Rule, commands []string) []Detection {
+	if rule.ArgRegex == nil {
+		return nil
+	}
+
+	var detections []Detection
+	for _, command := range commands {
+		if v, ok := rule.Normalize(rule.Find(rule.ArgRegex, command)); ok {
+			detections = append(detections, Detection{
+				ApplicationName: rule.ApplicationName,
+				Component:       rule.RoleComponents[rules.ContainerRoleInit],
+				Category:        rule.Category,
+				Version:         v,
+				HasVersion:      true,
+				Confidence:      capConfidence(rule, rules.ConfidenceMedium),
+			})
+		}
+	}
+	return detections
+}
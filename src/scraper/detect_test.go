@@ -0,0 +1,41 @@
+package scraper
+
+import "testing"
+
+func TestDetectImageRegistryPort(t *testing.T) {
+	detectionRules := loadRules(t, `version: "1"
+docker:
+  - applicationName: nginx
+    detectionRegex: '(\/)?nginx:'
+    versionRegex: ':(\d+)\.(\d+)(\.\d+)?$'
+  - applicationName: app
+    detectionRegex: '\/team\/app'
+    versionRegex: '(:(v)?(\d+)\.(\d+)(\.(\d+))?)((@sha)?.*)?$'
+`)
+	tests := []struct {
+		image          string
+		wantApp        string
+		wantVersion    string
+		wantHasVersion bool
+	}{
+		{"host:5000/nginx:1.25", "nginx", "1.25.0", true},
+		{"registry.internal:5000/nginx:1.25.3", "nginx", "1.25.3", true},
+		{"localhost:5000/team/app:v1.2.3", "app", "1.2.3", true},
+		{"registry.internal:5000/team/app:1.2", "app", "1.2.0", true},
+		// the port is no tag
+		{"registry.internal:5000/team/app", "app", "", false},
+		{"10.0.0.1:5000/team/app@sha256:0123456789abcdef0123456789abcdef", "app", "", false},
+	}
+	for _, tt := range tests {
+		detections := DetectImage(tt.image, ImageContext{}, detectionRules)
+		if len(detections) != 1 {
+			t.Errorf("DetectImage(%q) returned %d detections, want 1: %+v", tt.image, len(detections), detections)
+			continue
+		}
+		d := detections[0]
+		if d.ApplicationName != tt.wantApp || d.Version != tt.wantVersion || d.HasVersion != tt.wantHasVersion {
+			t.Errorf("DetectImage(%q) = %s %q %v, want %s %q %v",
+				tt.image, d.ApplicationName, d.Version, d.HasVersion, tt.wantApp, tt.wantVersion, tt.wantHasVersion)
+		}
+	}
+}
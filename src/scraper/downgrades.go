@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"cmp"
+	"encoding/json"
+	"keepup-helm-scraper/src/rules"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+// Downgrade is an application running at a lower version than in the
+// previous scrape, f/e after an accidental rollback.
+type Downgrade struct {
+	Application     string `json:"application"`
+	Namespace       string `json:"namespace"`
+	Source          string `json:"source"`
+	PreviousVersion string `json:"previous_version"`
+	Version         string `json:"version"`
+}
+
+// comparableVersion matches the versions a downgrade is looked for in, the
+// normalized ones of semver and calver rules and Helm charts; raw versions
+// like stable have no order.
+var comparableVersion = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
+// VersionHistory keeps the highest version of every application by
+// namespace and source a scrape of a cluster reported, so the next one can
+// tell downgrades. Applications missing from a scrape, f/e of a namespace
+// that failed to scan, keep their version.
+type VersionHistory struct {
+	mu       sync.Mutex
+	versions map[versionKey]string
+}
+
+type versionKey struct {
+	Namespace   string
+	Application string
+	Source      string
+}
+
+func NewVersionHistory() *VersionHistory {
+	return &VersionHistory{versions: make(map[versionKey]string)}
+}
+
+// historyEntry is a version of the JSON encoding of a VersionHistory.
+type historyEntry struct {
+	Namespace   string `json:"namespace"`
+	Application string `json:"application"`
+	Source      string `json:"source"`
+	Version     string `json:"version"`
+}
+
+// MarshalJSON encodes the versions as a sorted list, so they can be kept
+// over runs, f/e by one-shot CronJob runs.
+func (h *VersionHistory) MarshalJSON() ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]historyEntry, 0, len(h.versions))
+	for key, version := range h.versions {
+		entries = append(entries, historyEntry{key.Namespace, key.Application, key.Source, version})
+	}
+	slices.SortFunc(entries, func(a, b historyEntry) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Application, b.Application),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+	return json.Marshal(entries)
+}
+
+// UnmarshalJSON adds the versions MarshalJSON encoded to the history.
+func (h *VersionHistory) UnmarshalJSON(data []byte) error {
+	var entries []historyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range entries {
+		h.versions[versionKey{Namespace: e.Namespace, Application: e.Application, Source: e.Source}] = e.Version
+	}
+	return nil
+}
+
+// downgrades returns the applications whose highest version is lower than
+// in the previous scrape, sorted, and keeps the versions of the charts for
+// the next one.
+func (h *VersionHistory) downgrades(charts []HelmChartInfo) []Downgrade {
+	current := make(map[versionKey]string)
+	for _, c := range charts {
+		if !comparableVersion.MatchString(c.Version) {
+			continue
+		}
+		key := versionKey{Namespace: c.Namespace, Application: c.ChartName, Source: c.Source}
+		if v, ok := current[key]; !ok || rules.CompareVersions(c.Version, v) > 0 {
+			current[key] = c.Version
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var downgrades []Downgrade
+	for key, version := range current {
+		if previous, ok := h.versions[key]; ok && rules.CompareVersions(version, previous) < 0 {
+			log.Printf("Application %s in namespace %s went down from %s to %s", key.Application, key.Namespace, previous, version)
+			downgrades = append(downgrades, Downgrade{
+				Application:     key.Application,
+				Namespace:       key.Namespace,
+				Source:          key.Source,
+				PreviousVersion: previous,
+				Version:         version,
+			})
+		}
+	}
+	maps.Copy(h.versions, current)
+
+	slices.SortFunc(downgrades, func(a, b Downgrade) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Application, b.Application),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+	return downgrades
+}
@@ -0,0 +1,29 @@
+package scraper
+
+import "testing"
+
+func TestVersionHistoryOverRuns(t *testing.T) {
+	previous := NewVersionHistory()
+	previous.downgrades([]HelmChartInfo{
+		{ChartName: "nginx", Version: "1.26.0", Namespace: "shop", Source: SourceImage},
+		{ChartName: "redis", Version: "7.2.0", Namespace: "shop", Source: SourceImage},
+	})
+	data, err := previous.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next one-shot run starts from the kept versions
+	history := NewVersionHistory()
+	if err := history.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	got := history.downgrades([]HelmChartInfo{
+		{ChartName: "nginx", Version: "1.25.3", Namespace: "shop", Source: SourceImage},
+		{ChartName: "redis", Version: "7.2.1", Namespace: "shop", Source: SourceImage},
+	})
+	want := Downgrade{Application: "nginx", Namespace: "shop", Source: SourceImage, PreviousVersion: "1.26.0", Version: "1.25.3"}
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("downgrades() = %+v, want [%+v]", got, want)
+	}
+}
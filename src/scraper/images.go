@@ -0,0 +1,1007 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"keepup-helm-scraper/src/crd"
+	"keepup-helm-scraper/src/reference"
+	"keepup-helm-scraper/src/registry"
+	"keepup-helm-scraper/src/rules"
+	"log"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceTotals are the summed container requests and limits of a component
+// over all replicas of the workloads running it.
+type ResourceTotals struct {
+	CPURequests    string `json:"cpu_requests,omitempty"`
+	CPULimits      string `json:"cpu_limits,omitempty"`
+	MemoryRequests string `json:"memory_requests,omitempty"`
+	MemoryLimits   string `json:"memory_limits,omitempty"`
+}
+
+// ReplicaTotals are the summed desired and running replicas of the workloads
+// running a component, so defined but scaled down components can be told apart.
+type ReplicaTotals struct {
+	Desired int64 `json:"desired"`
+	Running int64 `json:"running"`
+}
+
+// replicaCounts are the desired and ready replicas of a single workload.
+type replicaCounts struct {
+	desired int64
+	running int64
+}
+
+// imageUsage aggregates what is known about an image within a namespace.
+type imageUsage struct {
+	// normalized registry/repository of the images
+	repositories map[string]bool
+	// pod template annotations of the first workload running the image
+	annotations map[string]string
+	// command lines of init containers running the image
+	initCommands map[string]bool
+	// roles of the containers running the image, see rules.ContainerRole*
+	containerRoles map[string]bool
+	// OSes of the nodes the workloads running the image run on, see rules.OS*
+	oses map[string]bool
+	// pull policies of the containers and digests running pods resolved the image to
+	pullPolicies map[string]bool
+	imageIDs     map[string]bool
+	// names of the pull secrets of the pod templates running the image
+	pullSecrets map[string]bool
+	// containers referencing the image, over all workloads
+	collected []CollectedImage
+	replicas  ReplicaTotals
+	requests  corev1.ResourceList
+	limits    corev1.ResourceList
+	// whether the image runs in sidecar and in application containers
+	sidecar     bool
+	application bool
+}
+
+func newImageUsage() *imageUsage {
+	return &imageUsage{
+		repositories:   map[string]bool{},
+		initCommands:   map[string]bool{},
+		containerRoles: map[string]bool{},
+		oses:           map[string]bool{},
+		pullPolicies:   map[string]bool{},
+		imageIDs:       map[string]bool{},
+		pullSecrets:    map[string]bool{},
+		requests:       corev1.ResourceList{},
+		limits:         corev1.ResourceList{},
+	}
+}
+
+func (u *imageUsage) add(res corev1.ResourceRequirements, replicas int64) {
+	addResources(u.requests, res.Requests, replicas)
+	addResources(u.limits, res.Limits, replicas)
+}
+
+func (u *imageUsage) addReplicas(replicas replicaCounts) {
+	u.replicas.Desired += replicas.desired
+	u.replicas.Running += replicas.running
+}
+
+func (u *imageUsage) merge(other *imageUsage) {
+	for repo := range other.repositories {
+		u.repositories[repo] = true
+	}
+	for command := range other.initCommands {
+		u.initCommands[command] = true
+	}
+	for role := range other.containerRoles {
+		u.containerRoles[role] = true
+	}
+	for nodeOS := range other.oses {
+		u.oses[nodeOS] = true
+	}
+	for policy := range other.pullPolicies {
+		u.pullPolicies[policy] = true
+	}
+	for id := range other.imageIDs {
+		u.imageIDs[id] = true
+	}
+	for secret := range other.pullSecrets {
+		u.pullSecrets[secret] = true
+	}
+	u.collected = append(u.collected, other.collected...)
+	u.replicas.Desired += other.replicas.Desired
+	u.replicas.Running += other.replicas.Running
+	addResources(u.requests, other.requests, 1)
+	addResources(u.limits, other.limits, 1)
+	u.sidecar = u.sidecar || other.sidecar
+	u.application = u.application || other.application
+}
+
+// repository returns the registry and repository of the images; if they
+// come from several repositories, the first one in sort order.
+func (u *imageUsage) repository() (string, string) {
+	repos := slices.Sorted(maps.Keys(u.repositories))
+	if len(repos) == 0 {
+		return "", ""
+	}
+	registry, repository, _ := strings.Cut(repos[0], "/")
+	return registry, repository
+}
+
+// workloads returns the distinct workloads running the image, sorted, with
+// the roles of their containers running it: an image run by the init and the
+// main container of a pod is one workload with both roles.
+func (u *imageUsage) workloads() ([]workload, map[workload][]string) {
+	roles := make(map[workload][]string)
+	for _, c := range u.collected {
+		w := workload{Kind: c.Kind, Name: c.Name, HelmRelease: c.HelmRelease}
+		if !slices.Contains(roles[w], c.Role) {
+			roles[w] = append(roles[w], c.Role)
+		}
+	}
+	for _, r := range roles {
+		slices.Sort(r)
+	}
+
+	workloads := slices.SortedFunc(maps.Keys(roles), func(a, b workload) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Name, b.Name))
+	})
+	return workloads, roles
+}
+
+// helmRelease returns the Helm release of the workloads running the image;
+// if they come from several releases, the first one in sort order.
+func (u *imageUsage) helmRelease() string {
+	var releases []string
+	for _, c := range u.collected {
+		if c.HelmRelease != "" {
+			releases = append(releases, c.HelmRelease)
+		}
+	}
+	if len(releases) == 0 {
+		return ""
+	}
+	return slices.Min(releases)
+}
+
+// workloadAnnotations returns the collected annotations of the workloads
+// running the image; of a key set by several of them to different values,
+// the first value in sort order.
+func (u *imageUsage) workloadAnnotations() map[string]string {
+	var annotations map[string]string
+	for _, c := range u.collected {
+		for key, value := range c.Annotations {
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			if current, ok := annotations[key]; !ok || value < current {
+				annotations[key] = value
+			}
+		}
+	}
+	return annotations
+}
+
+// context returns what the rules may look at besides the image reference.
+func (u *imageUsage) context() ImageContext {
+	return ImageContext{
+		Annotations:    u.annotations,
+		InitCommands:   slices.Sorted(maps.Keys(u.initCommands)),
+		ContainerRoles: slices.Sorted(maps.Keys(u.containerRoles)),
+		OSes:           slices.Sorted(maps.Keys(u.oses)),
+	}
+}
+
+// onlySidecar reports whether the image never ran outside sidecar containers.
+func (u *imageUsage) onlySidecar() bool {
+	return u.sidecar && !u.application
+}
+
+func (u *imageUsage) totals() *ResourceTotals {
+	format := func(list corev1.ResourceList, name corev1.ResourceName) string {
+		if q, ok := list[name]; ok {
+			return q.String()
+		}
+		return ""
+	}
+	return &ResourceTotals{
+		CPURequests:    format(u.requests, corev1.ResourceCPU),
+		CPULimits:      format(u.limits, corev1.ResourceCPU),
+		MemoryRequests: format(u.requests, corev1.ResourceMemory),
+		MemoryLimits:   format(u.limits, corev1.ResourceMemory),
+	}
+}
+
+func addResources(dst, src corev1.ResourceList, times int64) {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		q, ok := src[name]
+		if !ok {
+			continue
+		}
+		q = q.DeepCopy()
+		q.Mul(times)
+		sum := dst[name]
+		sum.Add(q)
+		dst[name] = sum
+	}
+}
+
+// workload is a resource running pods, f/e a Deployment.
+type workload struct {
+	Kind string
+	Name string
+	// HelmRelease that deployed the workload, if any
+	HelmRelease string
+}
+
+// Where Helm and charts following the Kubernetes recommendations
+// record the release of a resource.
+const (
+	helmReleaseAnnotation = "meta.helm.sh/release-name"
+	instanceLabel         = "app.kubernetes.io/instance"
+)
+
+// DefaultHelmReleaseLabels are the annotation Helm sets on the resources
+// it manages and the label charts set, see Options.HelmReleaseLabels.
+var DefaultHelmReleaseLabels = []string{helmReleaseAnnotation, instanceLabel}
+
+// helmRelease returns the value of the first of Options.HelmReleaseLabels
+// set as an annotation or a label of the resource, empty with none.
+func (s *Scraper) helmRelease(labels, annotations map[string]string) string {
+	keys := s.opts.HelmReleaseLabels
+	if len(keys) == 0 {
+		keys = DefaultHelmReleaseLabels
+	}
+	for _, key := range keys {
+		if release := cmp.Or(annotations[key], labels[key]); release != "" {
+			return release
+		}
+	}
+	return ""
+}
+
+// CollectedImage is a container image as referenced by one container of a workload.
+type CollectedImage struct {
+	Image string `json:"image"`
+	// Kind and Name of the workload, f/e Deployment
+	Kind          string `json:"kind"`
+	Name          string `json:"name"`
+	ContainerName string `json:"container_name"`
+	// see rules.ContainerRole*
+	Role        string            `json:"role"`
+	HelmRelease string            `json:"helm_release,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type componentKey struct {
+	Namespace   string
+	Application string
+	Version     string
+}
+
+// imageScan is the outcome of scanning the workload images.
+type imageScan struct {
+	charts []HelmChartInfo
+	// workloads that couldn't be read
+	errors []ScrapeError
+	// workloads without containers
+	anomalies []Anomaly
+	// malformed references, not run through the rules
+	invalidImages []InvalidImage
+	// applications of the rules that matched no image
+	unmatchedRules []string
+	// images no rule matched, by workload
+	unmatchedImages []UnmatchedImage
+	// workloads collected and whether MaxWorkloads stopped the collection
+	// in the last of the scanned namespaces
+	workloads         int
+	scannedNamespaces int
+	truncated         bool
+}
+
+// scanImages collects workload images of the namespaces and reports the
+// applications detected by the rules.
+func (s *Scraper) scanImages(ctx context.Context, namespaces []string) imageScan {
+	imagesByNs, scrapeErrors, anomalies, workloads, truncated := s.collectNamespaceImages(ctx, namespaces)
+	var invalidImages []InvalidImage
+	var unmatchedImages []UnmatchedImage
+
+	matches := make(map[string]int)
+	for _, rule := range s.rules {
+		matches[rule.ApplicationName] = 0
+	}
+
+	// applications of the images matched by more than one of them
+	overlaps := make(map[string][]string)
+
+	// pull credentials by namespace/secret, read once per scrape
+	pullCredentials := make(map[string]registry.Credentials)
+
+	// versions the resolver printed by image, run once per scrape
+	resolvedVersions := make(map[string]func() (string, error))
+
+	// category of each application, of the first rule setting one
+	categories := make(map[string]string)
+
+	// one entry per version, so an application running at two versions in a
+	// namespace is reported twice
+	usageByComponent := make(map[componentKey]*imageUsage)
+	// images merged into each component, as several detections of an image,
+	// f/e of two rules of the application, must not count its usage twice
+	mergedImages := make(map[componentKey]map[string]bool)
+	// the highest confidence of the detections of a component
+	confidences := make(map[componentKey]string)
+	for ns, images := range imagesByNs {
+		log.Println("Processing namespace:", ns)
+		for img, usage := range images {
+			if err := reference.Validate(img); err != nil {
+				log.Printf("Invalid image reference %q in namespace %s: %v", img, ns, err)
+				invalidImages = append(invalidImages, InvalidImage{Namespace: ns, Image: img, Reason: err.Error()})
+				continue
+			}
+			if matchesAny(s.opts.ExcludeImages, img) {
+				log.Printf("Excluded image %s", img)
+				continue
+			}
+			ictx := usage.context()
+			if s.opts.ImageLabels != nil {
+				ictx.Labels = sync.OnceValues(func() (map[string]string, error) {
+					creds := s.pullSecretCredentials(ctx, ns, usage.pullSecrets, pullCredentials)
+					return s.opts.ImageLabels.Labels(ctx, img, creds)
+				})
+			}
+			if s.opts.VersionResolver != nil {
+				if _, ok := resolvedVersions[img]; !ok {
+					resolvedVersions[img] = sync.OnceValues(func() (string, error) {
+						return s.opts.VersionResolver.Resolve(ctx, img)
+					})
+				}
+				ictx.ResolveVersion = resolvedVersions[img]
+			}
+			detections := DetectImage(img, ictx, s.rules)
+			if len(detections) == 0 {
+				workloads, _ := usage.workloads()
+				for _, w := range workloads {
+					unmatchedImages = append(unmatchedImages, UnmatchedImage{Namespace: ns, Image: img, Kind: w.Kind, Name: w.Name})
+				}
+			}
+			if applications := detectedApplications(detections); len(applications) > 1 {
+				overlaps[img] = applications
+			}
+			for _, d := range detections {
+				log.Printf("Matched %s -> %s\n", img, d.Name())
+				matches[d.ApplicationName]++
+				if matchesAny(s.opts.ExcludeApplications, d.ApplicationName) || matchesAny(s.opts.ExcludeApplications, d.Name()) {
+					log.Printf("Excluded application %s", d.Name())
+					continue
+				}
+				if !d.HasVersion {
+					log.Printf("%-90s -> no version\n", img)
+					continue
+				}
+				log.Printf("Normalized %-90s -> %s\n", img, d.Version)
+				if s.opts.OnDetection != nil {
+					workloads, roles := usage.workloads()
+					for _, w := range workloads {
+						s.opts.OnDetection(ctx, DetectedComponent{
+							Namespace:      ns,
+							Kind:           w.Kind,
+							Name:           w.Name,
+							Image:          img,
+							ContainerRoles: roles[w],
+							HelmRelease:    w.HelmRelease,
+							Application:    d.Name(),
+							Category:       d.Category,
+							Version:        d.Version,
+							Confidence:     d.Confidence,
+						})
+					}
+				}
+				if _, ok := categories[d.Name()]; !ok && d.Category != "" {
+					categories[d.Name()] = d.Category
+				}
+
+				key := componentKey{Namespace: ns, Application: d.Name(), Version: d.Version}
+				if _, ok := usageByComponent[key]; !ok {
+					usageByComponent[key] = newImageUsage()
+					mergedImages[key] = make(map[string]bool)
+				}
+				if rules.CompareConfidence(d.Confidence, confidences[key]) > 0 {
+					confidences[key] = d.Confidence
+				}
+				if !mergedImages[key][img] {
+					mergedImages[key][img] = true
+					usageByComponent[key].merge(usage)
+				}
+			}
+		}
+	}
+
+	var imagesInstalled []HelmChartInfo
+	for key, usage := range usageByComponent {
+		info := HelmChartInfo{
+			ChartName:  key.Application,
+			Category:   categories[key.Application],
+			Version:    key.Version,
+			Namespace:  key.Namespace,
+			Source:     SourceImage,
+			Confidence: confidences[key],
+		}
+		info.Registry, info.Repository = usage.repository()
+		info.HelmRelease = usage.helmRelease()
+		info.Annotations = usage.workloadAnnotations()
+		info.Sidecar = usage.onlySidecar()
+		info.Count = int64(len(usage.collected))
+		info.ContainerRoles = slices.Sorted(maps.Keys(usage.containerRoles))
+		if s.opts.CollectImageIDs {
+			info.PullPolicies = slices.Sorted(maps.Keys(usage.pullPolicies))
+			info.ImageIDs = slices.Sorted(maps.Keys(usage.imageIDs))
+		}
+		info.Replicas = &usage.replicas
+		if s.opts.CollectResources {
+			info.Resources = usage.totals()
+		}
+		imagesInstalled = append(imagesInstalled, info)
+	}
+
+	var unmatchedRules []string
+	for application, count := range matches {
+		if count == 0 {
+			unmatchedRules = append(unmatchedRules, application)
+		}
+	}
+	slices.Sort(unmatchedRules)
+	if len(unmatchedRules) > 0 {
+		log.Printf("Rules without matches: %s", strings.Join(unmatchedRules, ", "))
+	}
+
+	logRuleOverlaps(overlaps)
+
+	slices.SortFunc(invalidImages, func(a, b InvalidImage) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Image, b.Image))
+	})
+	slices.SortFunc(unmatchedImages, func(a, b UnmatchedImage) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Image, b.Image),
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+
+	return imageScan{
+		charts:            imagesInstalled,
+		workloads:         workloads,
+		scannedNamespaces: len(imagesByNs),
+		truncated:         truncated,
+		errors:            scrapeErrors,
+		anomalies:         anomalies,
+		invalidImages:     invalidImages,
+		unmatchedRules:    unmatchedRules,
+		unmatchedImages:   unmatchedImages,
+	}
+}
+
+// pullSecretCredentials returns the registry credentials of the pull secrets
+// in the namespace. Secrets that can't be read are logged and skipped, so
+// their registries are accessed anonymously.
+func (s *Scraper) pullSecretCredentials(
+	ctx context.Context,
+	ns string,
+	names map[string]bool,
+	cache map[string]registry.Credentials,
+) registry.Credentials {
+	creds := make(registry.Credentials)
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		key := ns + "/" + name
+		secretCreds, ok := cache[key]
+		if !ok {
+			secret, err := s.client.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+			if err == nil {
+				data, found := secret.Data[corev1.DockerConfigJsonKey]
+				if !found {
+					data = secret.Data[corev1.DockerConfigKey]
+				}
+				secretCreds, err = registry.ParseDockerConfig(data)
+			}
+			if err != nil {
+				log.Printf("Can't read pull secret %s: %v", key, err)
+			}
+			cache[key] = secretCreds
+		}
+		maps.Copy(creds, secretCreds)
+	}
+	return creds
+}
+
+// detectedApplications returns the distinct applications of the detections.
+func detectedApplications(detections []Detection) []string {
+	var applications []string
+	for _, d := range detections {
+		if !slices.Contains(applications, d.ApplicationName) {
+			applications = append(applications, d.ApplicationName)
+		}
+	}
+	return applications
+}
+
+// logRuleOverlaps logs the images matched by the rules of several
+// applications and, per set of overlapping applications, how many images
+// they share, so rules reporting one image twice can be cleaned up.
+func logRuleOverlaps(overlaps map[string][]string) {
+	if len(overlaps) == 0 {
+		return
+	}
+
+	images := make(map[string]int)
+	for _, img := range slices.Sorted(maps.Keys(overlaps)) {
+		applications := strings.Join(overlaps[img], ", ")
+		log.Printf("Image %s matched the rules of several applications: %s", img, applications)
+		images[applications]++
+	}
+	for _, applications := range slices.Sorted(maps.Keys(images)) {
+		log.Printf("Overlapping rules: %s (%d images)", applications, images[applications])
+	}
+}
+
+// CollectImages returns the images of the workloads in the scanned namespaces
+// by namespace, before any rule runs, f/e to write rules against what a
+// cluster runs. Workloads failing to collect are logged and skipped.
+func (s *Scraper) CollectImages(ctx context.Context) (map[string][]CollectedImage, error) {
+	namespaces, err := s.namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, _, _, _, _ := s.collectNamespaceImages(ctx, namespaces)
+	images := make(map[string][]CollectedImage)
+	for ns, usages := range acc {
+		for _, img := range slices.Sorted(maps.Keys(usages)) {
+			if collected := usages[img].collected; len(collected) > 0 {
+				images[ns] = append(images[ns], collected...)
+			}
+		}
+	}
+	return images, nil
+}
+
+// collectNamespaceImages collects the images of every workload kind in the
+// namespaces. A kind failing to list, f/e for missing RBAC, or panicking on
+// a malformed object is skipped and returned as a ScrapeError. Workloads
+// without containers are returned as Anomalies. It returns the number of
+// workloads collected as well, and whether MaxWorkloads stopped it short.
+func (s *Scraper) collectNamespaceImages(
+	ctx context.Context,
+	namespaces []string,
+) (map[string]map[string]*imageUsage, []ScrapeError, []Anomaly, int, bool) {
+
+	// accumulate to internal set
+	acc := make(map[string]map[string]*imageUsage)
+	var scrapeErrors []ScrapeError
+	var anomalies []Anomaly
+
+	type collector struct {
+		stage   string
+		collect func() error
+	}
+
+	if s.opts.ScanCache != nil {
+		s.opts.ScanCache.begin()
+		defer s.opts.ScanCache.end()
+	}
+
+	// workloads of the namespaces done
+	workloads := 0
+	truncated := false
+	for _, nsName := range namespaces {
+		if _, ok := acc[nsName]; !ok {
+			acc[nsName] = make(map[string]*imageUsage)
+		}
+
+		collectors := []collector{
+			{StageDeployments, func() error { return s.collectFromDeployments(ctx, nsName, acc, &anomalies) }},
+			{StageStatefulSets, func() error { return s.collectFromStatefulSets(ctx, nsName, acc, &anomalies) }},
+			{StageDaemonSets, func() error { return s.collectFromDaemonSets(ctx, nsName, acc, &anomalies) }},
+		}
+		collectors = slices.DeleteFunc(collectors, func(c collector) bool {
+			return len(s.opts.Kinds) > 0 && !slices.Contains(s.opts.Kinds, c.stage)
+		})
+		for _, res := range s.opts.CRDs {
+			collectors = append(collectors, collector{
+				res.GVR.GroupResource().String(),
+				func() error { return s.collectFromCRD(ctx, nsName, res, acc, &anomalies) },
+			})
+		}
+		if s.opts.JobLookback > 0 {
+			collectors = append(collectors, collector{
+				StageJobs,
+				func() error { return s.collectFromCronJobRuns(ctx, nsName, acc, &anomalies) },
+			})
+		}
+		// after the workloads, pods only add to the images found in them
+		if s.opts.CollectImageIDs {
+			collectors = append(collectors, collector{
+				StagePods,
+				func() error { return s.collectImageIDs(ctx, nsName, acc) },
+			})
+		}
+
+		for _, c := range collectors {
+			if s.opts.MaxWorkloads > 0 && workloads+workloadCount(acc[nsName]) >= s.opts.MaxWorkloads {
+				log.Printf("Stopped collecting images at %s in namespace %s, MaxWorkloads is reached", c.stage, nsName)
+				truncated = true
+				break
+			}
+			if err := recovered(c.collect); err != nil {
+				log.Printf("Failed to collect %s in namespace %s: %v", c.stage, nsName, err)
+				scrapeErrors = append(scrapeErrors, ScrapeError{Namespace: nsName, Stage: c.stage, Message: err.Error()})
+			}
+		}
+		workloads += workloadCount(acc[nsName])
+		if truncated {
+			break
+		}
+	}
+
+	return acc, scrapeErrors, anomalies, workloads, truncated
+}
+
+// workloadCount counts the workloads running the images of a namespace.
+func workloadCount(images map[string]*imageUsage) int {
+	seen := make(map[workload]bool)
+	for _, usage := range images {
+		for _, c := range usage.collected {
+			seen[workload{Kind: c.Kind, Name: c.Name}] = true
+		}
+	}
+	return len(seen)
+}
+
+// recovered runs collect, returning a panic in it as an error so a single
+// malformed object doesn't lose the rest of the scrape.
+func recovered(collect func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return collect()
+}
+
+// collectImages adds the images of the pod template to the accumulator,
+// counting container resources once per replica. A template without
+// containers, f/e mutated by a broken admission webhook, is an anomaly.
+// The annotations of the workload are the collected ones, see
+// selectAnnotations.
+func (s *Scraper) collectImages(
+	owner workload,
+	annotations map[string]string,
+	template corev1.PodTemplateSpec,
+	replicas replicaCounts,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) {
+	if len(template.Spec.Containers) == 0 {
+		log.Printf("%s %s/%s has no containers in its pod template", owner.Kind, ns, owner.Name)
+		*anomalies = append(*anomalies, Anomaly{
+			Namespace: ns,
+			Kind:      owner.Kind,
+			Name:      owner.Name,
+			Message:   "no containers in the pod template",
+		})
+	}
+
+	// pod templates of Jobs or custom resources often carry the instance
+	// label when the resource itself doesn't
+	if owner.HelmRelease == "" {
+		owner.HelmRelease = s.helmRelease(template.Labels, template.Annotations)
+	}
+
+	nodeOS := podOS(template.Spec)
+
+	// replicas count once per image even if several containers run it
+	counted := make(map[string]bool)
+
+	add := func(c corev1.Container, role string) *imageUsage {
+		if s.opts.ContainerNameFilter != nil && !s.opts.ContainerNameFilter.MatchString(c.Name) {
+			return nil
+		}
+		usage, ok := acc[ns][c.Image]
+		if !ok {
+			usage = newImageUsage()
+			ref := reference.Parse(c.Image).Normalized()
+			usage.repositories[ref.Registry+"/"+ref.Repository] = true
+			usage.annotations = template.Annotations
+			acc[ns][c.Image] = usage
+		}
+		usage.collected = append(usage.collected, CollectedImage{
+			Image:         c.Image,
+			Kind:          owner.Kind,
+			Name:          owner.Name,
+			ContainerName: c.Name,
+			Role:          role,
+			HelmRelease:   owner.HelmRelease,
+			Annotations:   annotations,
+		})
+		for _, secret := range template.Spec.ImagePullSecrets {
+			usage.pullSecrets[secret.Name] = true
+		}
+		usage.containerRoles[role] = true
+		usage.oses[nodeOS] = true
+		if c.ImagePullPolicy != "" {
+			usage.pullPolicies[string(c.ImagePullPolicy)] = true
+		}
+		usage.add(c.Resources, replicas.desired)
+		if !counted[c.Image] {
+			counted[c.Image] = true
+			usage.addReplicas(replicas)
+		}
+		if s.isSidecar(c.Name) {
+			usage.sidecar = true
+		} else {
+			usage.application = true
+		}
+		return usage
+	}
+
+	for _, c := range template.Spec.Containers {
+		add(c, rules.ContainerRoleMain)
+	}
+	for _, c := range template.Spec.InitContainers {
+		if usage := add(c, rules.ContainerRoleInit); usage != nil {
+			command := strings.Join(append(slices.Clone(c.Command), c.Args...), " ")
+			usage.initCommands[command] = true
+		}
+	}
+}
+
+// selectAnnotations returns the annotations of Options.CollectAnnotations
+// the workload sets, nil without any.
+func (s *Scraper) selectAnnotations(annotations map[string]string) map[string]string {
+	var selected map[string]string
+	for _, key := range s.opts.CollectAnnotations {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		if selected == nil {
+			selected = make(map[string]string)
+		}
+		selected[key] = value
+	}
+	return selected
+}
+
+// podOS returns the OS of the nodes the pods run on, of spec.os or else the
+// kubernetes.io/os node selector. Pods setting neither are taken for Linux
+// ones, as Windows pods have to select Windows nodes to be scheduled there.
+func podOS(spec corev1.PodSpec) string {
+	if spec.OS != nil && spec.OS.Name != "" {
+		return string(spec.OS.Name)
+	}
+	if nodeOS := spec.NodeSelector[corev1.LabelOSStable]; nodeOS != "" {
+		return nodeOS
+	}
+	return rules.OSLinux
+}
+
+// collectImageIDs adds the digests running pods resolved the images to,
+// so a moved tag like latest can be noticed.
+func (s *Scraper) collectImageIDs(
+	ctx context.Context,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+) error {
+	pods, err := s.client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		images := make(map[string]string)
+		for _, c := range append(slices.Clone(pod.Spec.Containers), pod.Spec.InitContainers...) {
+			images[c.Name] = c.Image
+		}
+
+		statuses := append(slices.Clone(pod.Status.ContainerStatuses), pod.Status.InitContainerStatuses...)
+		for _, status := range statuses {
+			usage, ok := acc[ns][images[status.Name]]
+			if !ok || status.ImageID == "" {
+				continue
+			}
+			usage.imageIDs[imageDigest(status.ImageID)] = true
+		}
+	}
+	return nil
+}
+
+// imageDigest returns the digest of a container status imageID,
+// f/e docker-pullable://nginx@sha256:... -> sha256:...
+func imageDigest(imageID string) string {
+	if _, digest, ok := strings.Cut(imageID, "@"); ok {
+		return digest
+	}
+	return imageID
+}
+
+// isSidecar reports whether the container name starts with one of the
+// sidecar container names, f/e istio-proxy or linkerd-.
+func (s *Scraper) isSidecar(name string) bool {
+	for _, prefix := range s.opts.SidecarContainers {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// specReplicas returns the desired replicas, which default to 1 when unset,
+// with the ready ones.
+func specReplicas(desired *int32, ready int32) replicaCounts {
+	counts := replicaCounts{desired: 1, running: int64(ready)}
+	if desired != nil {
+		counts.desired = int64(*desired)
+	}
+	return counts
+}
+
+func (s *Scraper) collectFromDeployments(
+	ctx context.Context,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) error {
+	templates, err := listTemplates(ctx, s, ns, appsv1.SchemeGroupVersion.WithResource("deployments"),
+		s.client.AppsV1().Deployments(ns),
+		func(l *appsv1.DeploymentList) []appsv1.Deployment { return l.Items },
+		func(d *appsv1.Deployment) workloadTemplate {
+			return workloadTemplate{
+				owner:       workload{Kind: "Deployment", Name: d.Name, HelmRelease: s.helmRelease(d.Labels, d.Annotations)},
+				template:    d.Spec.Template,
+				replicas:    specReplicas(d.Spec.Replicas, d.Status.ReadyReplicas),
+				annotations: s.selectAnnotations(d.Annotations),
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	s.collectTemplates(templates, ns, acc, anomalies)
+	return nil
+}
+
+func (s *Scraper) collectFromStatefulSets(
+	ctx context.Context,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) error {
+	templates, err := listTemplates(ctx, s, ns, appsv1.SchemeGroupVersion.WithResource("statefulsets"),
+		s.client.AppsV1().StatefulSets(ns),
+		func(l *appsv1.StatefulSetList) []appsv1.StatefulSet { return l.Items },
+		func(set *appsv1.StatefulSet) workloadTemplate {
+			return workloadTemplate{
+				owner:       workload{Kind: "StatefulSet", Name: set.Name, HelmRelease: s.helmRelease(set.Labels, set.Annotations)},
+				template:    set.Spec.Template,
+				replicas:    specReplicas(set.Spec.Replicas, set.Status.ReadyReplicas),
+				annotations: s.selectAnnotations(set.Annotations),
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	s.collectTemplates(templates, ns, acc, anomalies)
+	return nil
+}
+
+func (s *Scraper) collectFromDaemonSets(
+	ctx context.Context,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) error {
+	templates, err := listTemplates(ctx, s, ns, appsv1.SchemeGroupVersion.WithResource("daemonsets"),
+		s.client.AppsV1().DaemonSets(ns),
+		func(l *appsv1.DaemonSetList) []appsv1.DaemonSet { return l.Items },
+		func(d *appsv1.DaemonSet) workloadTemplate {
+			return workloadTemplate{
+				owner:    workload{Kind: "DaemonSet", Name: d.Name, HelmRelease: s.helmRelease(d.Labels, d.Annotations)},
+				template: d.Spec.Template,
+				replicas: replicaCounts{
+					desired: int64(d.Status.DesiredNumberScheduled),
+					running: int64(d.Status.NumberReady),
+				},
+				annotations: s.selectAnnotations(d.Annotations),
+			}
+		})
+	if err != nil {
+		return err
+	}
+
+	s.collectTemplates(templates, ns, acc, anomalies)
+	return nil
+}
+
+// collectTemplates adds the images of the workload templates, see collectImages.
+func (s *Scraper) collectTemplates(
+	templates []workloadTemplate,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) {
+	for _, t := range templates {
+		s.collectImages(t.owner, t.annotations, t.template, t.replicas, ns, acc, anomalies)
+	}
+}
+
+// collectFromCronJobRuns collects the Jobs owned by CronJobs that started
+// within JobLookback, as their CronJob; other Jobs are skipped.
+func (s *Scraper) collectFromCronJobRuns(
+	ctx context.Context,
+	ns string,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) error {
+	jobs, err := s.client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs.Items {
+		owner := metav1.GetControllerOf(&job)
+		if owner == nil || owner.Kind != "CronJob" {
+			continue
+		}
+		started := job.CreationTimestamp.Time
+		if job.Status.StartTime != nil {
+			started = job.Status.StartTime.Time
+		}
+		if time.Since(started) > s.opts.JobLookback {
+			continue
+		}
+
+		replicas := specReplicas(job.Spec.Parallelism, job.Status.Active)
+		cronJob := workload{Kind: "CronJob", Name: owner.Name, HelmRelease: s.helmRelease(job.Labels, job.Annotations)}
+		s.collectImages(cronJob, s.selectAnnotations(job.Annotations), job.Spec.Template, replicas, ns, acc, anomalies)
+	}
+	return nil
+}
+
+func (s *Scraper) collectFromCRD(
+	ctx context.Context,
+	ns string,
+	res crd.Resource,
+	acc map[string]map[string]*imageUsage,
+	anomalies *[]Anomaly,
+) error {
+	templates, err := crd.CollectPodTemplates(ctx, s.opts.DynamicClient, ns, res)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range templates {
+		replicas := replicaCounts{desired: t.Replicas, running: t.ReadyReplicas}
+		template := corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: t.Annotations},
+			Spec:       t.Spec,
+		}
+		owner := workload{
+			Kind:        res.GVR.GroupResource().String(),
+			Name:        t.Name,
+			HelmRelease: s.helmRelease(t.ResourceLabels, t.ResourceAnnotations),
+		}
+		s.collectImages(owner, s.selectAnnotations(t.ResourceAnnotations), template, replicas, ns, acc, anomalies)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"keepup-helm-scraper/src/rules"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRecovered(t *testing.T) {
+	errList := errors.New("forbidden")
+	tests := []struct {
+		name    string
+		collect func() error
+		wantErr string
+	}{
+		{"success", func() error { return nil }, ""},
+		{"error", func() error { return errList }, "forbidden"},
+		{"panic", func() error { panic("malformed object") }, "panic: malformed object"},
+		{"runtime panic", func() error {
+			var m map[string]int
+			m["x"]++
+			return nil
+		}, "panic: assignment to entry in nil map"},
+	}
+	for _, tt := range tests {
+		err := recovered(tt.collect)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.wantErr {
+			t.Errorf("recovered(%s) = %q, want %q", tt.name, got, tt.wantErr)
+		}
+	}
+}
+
+func TestCollectNamespaceImagesRecoversPanic(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		panic("malformed deployment")
+	})
+	s := New(client, nil, Options{ScanImages: true})
+
+	_, scrapeErrors, _, _, _ := s.collectNamespaceImages(context.Background(), []string{"shop"})
+	if len(scrapeErrors) != 1 {
+		t.Fatalf("collectNamespaceImages returned %d errors, want 1: %+v", len(scrapeErrors), scrapeErrors)
+	}
+	got := scrapeErrors[0]
+	if got.Namespace != "shop" || got.Stage != StageDeployments || !strings.Contains(got.Message, "panic: malformed deployment") {
+		t.Errorf("collectNamespaceImages error = %+v, want the panic of deployments in shop", got)
+	}
+}
+
+// podTemplate returns a pod template of a container per image.
+func podTemplate(images ...string) corev1.PodTemplateSpec {
+	var spec corev1.PodSpec
+	for i, image := range images {
+		spec.Containers = append(spec.Containers, corev1.Container{Name: fmt.Sprintf("c%d", i), Image: image})
+	}
+	return corev1.PodTemplateSpec{Spec: spec}
+}
+
+func TestScanImagesMergesImageOnce(t *testing.T) {
+	replicas := int32(2)
+	client := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: podTemplate("registry.internal/nginx:1.25.1")},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 2},
+	})
+	// both rules of the application detect the same version of the image
+	detectionRules := loadRules(t, `version: "1"
+docker:
+  - applicationName: nginx
+    detectionRegex: '/nginx:'
+    versionRegex: ':(.+)$'
+  - applicationName: nginx
+    detectionRegex: 'registry\.internal/'
+    versionRegex: ':(.+)$'
+`)
+	s := New(client, detectionRules, Options{ScanImages: true})
+	scan := s.scanImages(context.Background(), []string{"shop"})
+
+	if len(scan.charts) != 1 {
+		t.Fatalf("scanImages returned %d entries, want 1: %+v", len(scan.charts), scan.charts)
+	}
+	got := scan.charts[0]
+	if got.Count != 1 {
+		t.Errorf("scanImages count = %d, want 1", got.Count)
+	}
+	if got.Replicas == nil || *got.Replicas != (ReplicaTotals{Desired: 2, Running: 2}) {
+		t.Errorf("scanImages replicas = %+v, want 2 desired, 2 running", got.Replicas)
+	}
+}
+
+func TestCollectNamespaceImages(t *testing.T) {
+	replicas := int32(2)
+	client := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: podTemplate("nginx:1.25.1", "envoyproxy/envoy:v1.29.1")},
+			Status:     appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "cache", Namespace: "shop"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas, Template: podTemplate("redis:7.2.4")},
+			Status:     appsv1.StatefulSetStatus{ReadyReplicas: 2},
+		},
+		&appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "logs", Namespace: "monitoring"},
+			Spec:       appsv1.DaemonSetSpec{Template: podTemplate("fluent/fluent-bit:3.0.2")},
+			Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, NumberReady: 3},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "skipped", Namespace: "other"},
+			Spec:       appsv1.DeploymentSpec{Template: podTemplate("nginx:1.25.1")},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "monitoring"},
+		},
+	)
+	s := New(client, nil, Options{ScanImages: true})
+
+	acc, scrapeErrors, anomalies, workloads, truncated := s.collectNamespaceImages(context.Background(), []string{"shop", "monitoring"})
+	if len(scrapeErrors) > 0 {
+		t.Fatalf("collectNamespaceImages returned errors: %+v", scrapeErrors)
+	}
+	// workloads running images, so not broken
+	if workloads != 3 || truncated {
+		t.Errorf("collectNamespaceImages collected %d workloads, truncated %v; want 3, false", workloads, truncated)
+	}
+	if len(anomalies) != 1 || anomalies[0].Namespace != "monitoring" || anomalies[0].Name != "broken" {
+		t.Errorf("collectNamespaceImages anomalies = %+v, want monitoring/broken without containers", anomalies)
+	}
+
+	want := map[string][]string{
+		"shop":       {"envoyproxy/envoy:v1.29.1", "nginx:1.25.1", "redis:7.2.4"},
+		"monitoring": {"fluent/fluent-bit:3.0.2"},
+	}
+	if got := slices.Sorted(maps.Keys(acc)); !slices.Equal(got, []string{"monitoring", "shop"}) {
+		t.Fatalf("collectNamespaceImages namespaces = %v, want [monitoring shop]", got)
+	}
+	for ns, images := range want {
+		if got := slices.Sorted(maps.Keys(acc[ns])); !slices.Equal(got, images) {
+			t.Errorf("images of %s = %v, want %v", ns, got, images)
+		}
+	}
+
+	nginx := acc["shop"]["nginx:1.25.1"]
+	if len(nginx.collected) != 1 || nginx.collected[0].Kind != "Deployment" || nginx.collected[0].Name != "web" {
+		t.Errorf("nginx collected = %+v, want Deployment web", nginx.collected)
+	}
+	if nginx.replicas != (ReplicaTotals{Desired: 2, Running: 1}) {
+		t.Errorf("nginx replicas = %+v, want 2 desired, 1 running", nginx.replicas)
+	}
+	if fluentBit := acc["monitoring"]["fluent/fluent-bit:3.0.2"]; fluentBit.replicas != (ReplicaTotals{Desired: 3, Running: 3}) {
+		t.Errorf("fluent-bit replicas = %+v, want 3 desired, 3 running", fluentBit.replicas)
+	}
+}
+
+// loadRules loads the docker rules of the rules file content.
+func loadRules(t *testing.T, content string) []rules.Rule {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keepup-detection.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := rules.LoadRules(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestScanImagesSharedInitImage(t *testing.T) {
+	replicas := int32(2)
+	template := podTemplate("registry.internal/myapp:1.4.2")
+	template.Spec.InitContainers = []corev1.Container{
+		{Name: "migrate", Image: "registry.internal/myapp:1.4.2", Command: []string{"myapp", "migrate"}},
+	}
+	client := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "shop"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Template: template},
+		Status:     appsv1.DeploymentStatus{ReadyReplicas: 2},
+	})
+	detectionRules := loadRules(t, `version: "1"
+docker:
+  - applicationName: myapp
+    detectionRegex: '/myapp:'
+    versionRegex: ':(.+)$'
+`)
+
+	var detected []DetectedComponent
+	s := New(client, detectionRules, Options{
+		ScanImages:  true,
+		OnDetection: func(_ context.Context, c DetectedComponent) { detected = append(detected, c) },
+	})
+	scan := s.scanImages(context.Background(), []string{"shop"})
+
+	if len(scan.charts) != 1 {
+		t.Fatalf("scanImages returned %d entries, want 1: %+v", len(scan.charts), scan.charts)
+	}
+	got := scan.charts[0]
+	if got.ChartName != "myapp" || got.Version != "1.4.2" || !slices.Equal(got.ContainerRoles, []string{rules.ContainerRoleInit, rules.ContainerRoleMain}) {
+		t.Errorf("scanImages entry = %s %s %v, want myapp 1.4.2 with the init and main roles", got.ChartName, got.Version, got.ContainerRoles)
+	}
+	// replicas count once per pod, not per container
+	if got.Replicas == nil || *got.Replicas != (ReplicaTotals{Desired: 2, Running: 2}) {
+		t.Errorf("scanImages replicas = %+v, want 2 desired, 2 running", got.Replicas)
+	}
+
+	if len(detected) != 1 || !slices.Equal(detected[0].ContainerRoles, []string{rules.ContainerRoleInit, rules.ContainerRoleMain}) {
+		t.Errorf("OnDetection got %+v, want one detection with the init and main roles", detected)
+	}
+}
@@ -0,0 +1,137 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+)
+
+// ScanCache keeps the pod templates of the Deployments, StatefulSets and
+// DaemonSets read by the previous scrape of a cluster, so the next one lists
+// only their metadata and reads just the workloads whose resourceVersion
+// changed since. Any change of a workload, its status included, changes the
+// resourceVersion, so cached templates are as current as the metadata list.
+// Scrapes sharing a cache run one after the other.
+type ScanCache struct {
+	client metadata.Interface
+
+	mu      sync.Mutex
+	current map[cacheKey]cachedWorkload
+	next    map[cacheKey]cachedWorkload
+}
+
+// NewScanCache returns an empty cache listing workloads with the client.
+func NewScanCache(client metadata.Interface) *ScanCache {
+	return &ScanCache{client: client}
+}
+
+type cacheKey struct {
+	namespace string
+	resource  string
+	name      string
+}
+
+type cachedWorkload struct {
+	resourceVersion string
+	workloadTemplate
+}
+
+// workloadTemplate is the pod template of a workload with its replicas.
+type workloadTemplate struct {
+	owner    workload
+	template corev1.PodTemplateSpec
+	replicas replicaCounts
+	// of the workload, only the keys of Options.CollectAnnotations
+	annotations map[string]string
+}
+
+// begin starts a scan, waiting for a running one to end.
+func (c *ScanCache) begin() {
+	c.mu.Lock()
+	c.next = make(map[cacheKey]cachedWorkload)
+}
+
+// end keeps what the scan read for the next one, dropping the workloads
+// it didn't see, f/e deleted ones or ones of a kind that failed to list.
+func (c *ScanCache) end() {
+	c.current, c.next = c.next, nil
+	c.mu.Unlock()
+}
+
+// templates lists the metadata of the resource in the namespace and returns
+// the cached templates of the unchanged workloads and the ones of the others
+// read with get.
+func (c *ScanCache) templates(
+	ctx context.Context,
+	ns string,
+	gvr schema.GroupVersionResource,
+	get func(name string) (workloadTemplate, error),
+) ([]workloadTemplate, error) {
+	list, err := c.client.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []workloadTemplate
+	for _, item := range list.Items {
+		key := cacheKey{namespace: ns, resource: gvr.Resource, name: item.Name}
+		cached, ok := c.current[key]
+		if !ok || cached.resourceVersion != item.ResourceVersion {
+			t, err := get(item.Name)
+			if apierrors.IsNotFound(err) {
+				// deleted since the list
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			cached = cachedWorkload{resourceVersion: item.ResourceVersion, workloadTemplate: t}
+		}
+		c.next[key] = cached
+		templates = append(templates, cached.workloadTemplate)
+	}
+	return templates, nil
+}
+
+// workloadClient lists and gets a kind of workloads, f/e a DeploymentInterface.
+type workloadClient[W, L any] interface {
+	List(ctx context.Context, opts metav1.ListOptions) (L, error)
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*W, error)
+}
+
+// listTemplates returns the pod templates of a kind of workloads in the
+// namespace, listed in full or through the ScanCache when there's one.
+func listTemplates[W, L any](
+	ctx context.Context,
+	s *Scraper,
+	ns string,
+	gvr schema.GroupVersionResource,
+	client workloadClient[W, L],
+	items func(L) []W,
+	template func(*W) workloadTemplate,
+) ([]workloadTemplate, error) {
+	if s.opts.ScanCache != nil {
+		return s.opts.ScanCache.templates(ctx, ns, gvr, func(name string) (workloadTemplate, error) {
+			w, err := client.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return workloadTemplate{}, err
+			}
+			return template(w), nil
+		})
+	}
+
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var templates []workloadTemplate
+	for _, w := range items(list) {
+		templates = append(templates, template(&w))
+	}
+	return templates, nil
+}
@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"keepup-helm-scraper/src/helm"
+	"keepup-helm-scraper/src/reference"
+	"keepup-helm-scraper/src/rules"
+	"log"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// scanHelmManifests runs the rules over the images of the pod specs in the
+// manifests of the releases and reports one entry per application, version
+// and namespace with the number of containers running it. The manifests are
+// what the releases deployed, so images patched into the workloads since
+// aren't seen, while those of CronJobs or custom resources that no collector
+// scans are.
+func (s *Scraper) scanHelmManifests(ctx context.Context, releases []helm.Release) ([]HelmChartInfo, []ScrapeError) {
+	var scrapeErrors []ScrapeError
+	charts := make(map[componentKey]*HelmChartInfo)
+	for _, r := range releases {
+		templates, err := r.PodTemplates()
+		if err != nil {
+			log.Printf("Failed to parse the manifest of Helm release %s/%s: %v", r.Namespace, r.Name, err)
+			scrapeErrors = append(scrapeErrors, ScrapeError{
+				Namespace: r.Namespace,
+				Stage:     StageHelmManifest,
+				Message:   fmt.Sprintf("release %s: %v", r.Name, err),
+			})
+			continue
+		}
+
+		for _, t := range templates {
+			ns := cmp.Or(t.Namespace, r.Namespace)
+			detect := func(c corev1.Container, role string, initCommands []string) {
+				if s.opts.ContainerNameFilter != nil && !s.opts.ContainerNameFilter.MatchString(c.Name) {
+					return
+				}
+				if err := reference.Validate(c.Image); err != nil {
+					log.Printf("Invalid image reference %q in the manifest of Helm release %s/%s: %v", c.Image, r.Namespace, r.Name, err)
+					return
+				}
+				if matchesAny(s.opts.ExcludeImages, c.Image) {
+					return
+				}
+				ictx := ImageContext{
+					Annotations:    t.Annotations,
+					InitCommands:   initCommands,
+					ContainerRoles: []string{role},
+					OSes:           []string{podOS(t.Spec)},
+				}
+				for _, d := range DetectImage(c.Image, ictx, s.rules) {
+					if matchesAny(s.opts.ExcludeApplications, d.ApplicationName) || matchesAny(s.opts.ExcludeApplications, d.Name()) {
+						continue
+					}
+					if !d.HasVersion {
+						continue
+					}
+					if s.opts.OnDetection != nil {
+						s.opts.OnDetection(ctx, DetectedComponent{
+							Namespace:      ns,
+							Kind:           t.Kind,
+							Name:           t.Name,
+							Image:          c.Image,
+							ContainerRoles: []string{role},
+							HelmRelease:    r.Name,
+							Application:    d.Name(),
+							Category:       d.Category,
+							Version:        d.Version,
+							Confidence:     d.Confidence,
+						})
+					}
+
+					key := componentKey{Namespace: ns, Application: d.Name(), Version: d.Version}
+					info, ok := charts[key]
+					if !ok {
+						ref := reference.Parse(c.Image).Normalized()
+						info = &HelmChartInfo{
+							ChartName:   key.Application,
+							Version:     key.Version,
+							Namespace:   key.Namespace,
+							Source:      SourceHelmManifest,
+							Registry:    ref.Registry,
+							Repository:  ref.Repository,
+							HelmRelease: r.Name,
+						}
+						charts[key] = info
+					}
+					info.Count++
+					info.Category = cmp.Or(info.Category, d.Category)
+					info.HelmRelease = min(info.HelmRelease, r.Name)
+					if rules.CompareConfidence(d.Confidence, info.Confidence) > 0 {
+						info.Confidence = d.Confidence
+					}
+					if !slices.Contains(info.ContainerRoles, role) {
+						info.ContainerRoles = append(info.ContainerRoles, role)
+						slices.Sort(info.ContainerRoles)
+					}
+				}
+			}
+
+			for _, c := range t.Spec.Containers {
+				detect(c, rules.ContainerRoleMain, nil)
+			}
+			for _, c := range t.Spec.InitContainers {
+				command := strings.Join(append(slices.Clone(c.Command), c.Args...), " ")
+				detect(c, rules.ContainerRoleInit, []string{command})
+			}
+		}
+	}
+
+	var result []HelmChartInfo
+	for _, info := range charts {
+		result = append(result, *info)
+	}
+	return result, scrapeErrors
+}
@@ -0,0 +1,131 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"keepup-helm-scraper/src/reference"
+	"keepup-helm-scraper/src/rules"
+	"log"
+	"regexp"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Applications of the mesh proxies, as reported.
+const (
+	MeshIstioProxy   = "istio-proxy"
+	MeshLinkerdProxy = "linkerd-proxy"
+)
+
+const (
+	// the containers the Istio injector added, f/e {"containers":["istio-proxy"],...};
+	// it doesn't carry the version, their image tag does
+	istioStatusAnnotation = "sidecar.istio.io/status"
+	// the version of the injected Linkerd proxy, f/e stable-2.14.10
+	linkerdVersionAnnotation = "linkerd.io/proxy-version"
+)
+
+var meshVersionRegex = regexp.MustCompile(rules.DefaultVersionRegex)
+
+// istioStatus is the part of the Istio status annotation naming the injected containers.
+type istioStatus struct {
+	Containers     []string `json:"containers"`
+	InitContainers []string `json:"initContainers"`
+}
+
+// scanMesh reports the mesh proxies the injectors of Istio and Linkerd added
+// to the pods of the namespaces, once per version and namespace with the
+// number of pods running it. Their annotations are only set on the pods,
+// not on the pod templates of the workloads.
+func (s *Scraper) scanMesh(ctx context.Context, namespaces []string) ([]HelmChartInfo, []ScrapeError) {
+	var charts []HelmChartInfo
+	var scrapeErrors []ScrapeError
+	for _, ns := range namespaces {
+		pods, err := s.client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			log.Printf("Failed to collect %s in namespace %s: %v", StagePods, ns, err)
+			scrapeErrors = append(scrapeErrors, ScrapeError{Namespace: ns, Stage: StagePods, Message: err.Error()})
+			continue
+		}
+
+		counts := make(map[componentKey]int64)
+		for _, pod := range pods.Items {
+			for application, version := range meshProxies(pod) {
+				if matchesAny(s.opts.ExcludeApplications, application) {
+					continue
+				}
+				counts[componentKey{Namespace: ns, Application: application, Version: version}]++
+			}
+		}
+		for key, count := range counts {
+			charts = append(charts, HelmChartInfo{
+				ChartName:  key.Application,
+				Version:    key.Version,
+				Namespace:  key.Namespace,
+				Source:     SourceMesh,
+				Confidence: meshConfidence(key.Application),
+				Count:      count,
+			})
+		}
+	}
+	return charts, scrapeErrors
+}
+
+// meshProxies returns the versions of the mesh proxies injected into the pod
+// by application.
+func meshProxies(pod corev1.Pod) map[string]string {
+	proxies := make(map[string]string)
+	if v := pod.Annotations[linkerdVersionAnnotation]; v != "" {
+		proxies[MeshLinkerdProxy] = meshVersion(v)
+	}
+	if v, ok := istioProxyVersion(pod); ok {
+		proxies[MeshIstioProxy] = v
+	}
+	return proxies
+}
+
+// istioProxyVersion returns the image tag of the first container the Istio
+// status annotation names, istio-init and native sidecars included, which
+// all run the proxy image.
+func istioProxyVersion(pod corev1.Pod) (string, bool) {
+	annotation, ok := pod.Annotations[istioStatusAnnotation]
+	if !ok {
+		return "", false
+	}
+	var status istioStatus
+	if err := json.Unmarshal([]byte(annotation), &status); err != nil {
+		log.Printf("Can't read %s of pod %s/%s: %v", istioStatusAnnotation, pod.Namespace, pod.Name, err)
+		return "", false
+	}
+
+	containers := append(slices.Clone(pod.Spec.Containers), pod.Spec.InitContainers...)
+	for _, c := range containers {
+		if !slices.Contains(status.Containers, c.Name) && !slices.Contains(status.InitContainers, c.Name) {
+			continue
+		}
+		if tag := reference.Parse(c.Image).Tag; tag != "" {
+			return meshVersion(tag), true
+		}
+	}
+	return "", false
+}
+
+// meshConfidence returns the confidence of the version of the mesh proxy:
+// Istio's is the image tag, Linkerd's an annotation.
+func meshConfidence(application string) string {
+	if application == MeshLinkerdProxy {
+		return rules.ConfidenceMedium
+	}
+	return rules.ConfidenceHigh
+}
+
+// meshVersion normalizes the version like the rules do, f/e stable-2.14.10 ->
+// 2.14.10 or 1.22.1-distroless -> 1.22.1, keeping it as is without one.
+func meshVersion(v string) string {
+	if normalized, ok := rules.NormalizeSemVer(v, meshVersionRegex); ok {
+		return normalized
+	}
+	return v
+}
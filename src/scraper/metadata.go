@@ -0,0 +1,54 @@
+package scraper
+
+import (
+	"sync"
+	"time"
+)
+
+// Keys of the values of a MetadataCache.
+const (
+	metadataClusterName = "cluster-name"
+	metadataKubeVersion = "kube-version"
+)
+
+// MetadataCache keeps the cluster name and Kubernetes version a scrape
+// looked up for a TTL, so the following scrapes of a cluster don't query
+// the apiserver for them again. Fallbacks like unknown-version aren't kept,
+// so a failed lookup is retried by the next scrape.
+type MetadataCache struct {
+	ttl time.Duration
+
+	mu     sync.Mutex
+	values map[string]cachedMetadata
+}
+
+type cachedMetadata struct {
+	value   string
+	expires time.Time
+}
+
+// NewMetadataCache returns an empty cache keeping values for the TTL.
+func NewMetadataCache(ttl time.Duration) *MetadataCache {
+	return &MetadataCache{ttl: ttl, values: make(map[string]cachedMetadata)}
+}
+
+// get returns the cached value of the key, calling lookup when it's missing
+// or expired and keeping what it returns unless it reports false. A nil
+// cache always calls lookup.
+func (c *MetadataCache) get(key string, lookup func() (string, bool)) string {
+	if c == nil {
+		value, _ := lookup()
+		return value
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.values[key]; ok && time.Now().Before(cached.expires) {
+		return cached.value
+	}
+	value, ok := lookup()
+	if ok {
+		c.values[key] = cachedMetadata{value: value, expires: time.Now().Add(c.ttl)}
+	}
+	return value
+}
@@ -0,0 +1,39 @@
+package scraper
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeInfo is the software a node runs, from its status.nodeInfo.
+type NodeInfo struct {
+	Name                    string `json:"name"`
+	OSImage                 string `json:"os_image"`
+	KernelVersion           string `json:"kernel_version"`
+	ContainerRuntimeVersion string `json:"container_runtime_version"`
+	KubeletVersion          string `json:"kubelet_version"`
+	Architecture            string `json:"architecture"`
+}
+
+func listNodes(ctx context.Context, client kubernetes.Interface) ([]NodeInfo, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []NodeInfo
+	for _, n := range nodes.Items {
+		info := n.Status.NodeInfo
+		infos = append(infos, NodeInfo{
+			Name:                    n.Name,
+			OSImage:                 info.OSImage,
+			KernelVersion:           info.KernelVersion,
+			ContainerRuntimeVersion: info.ContainerRuntimeVersion,
+			KubeletVersion:          info.KubeletVersion,
+			Architecture:            info.Architecture,
+		})
+	}
+	return infos, nil
+}
@@ -0,0 +1,632 @@
+// Package scraper collects the applications running in a cluster, detected
+// from workload images by the rules and from Helm release secrets.
+// It reads no environment, the caller passes everything in Options.
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"keepup-helm-scraper/src/crd"
+	"keepup-helm-scraper/src/helm"
+	"keepup-helm-scraper/src/reference"
+	"keepup-helm-scraper/src/registry"
+	"keepup-helm-scraper/src/resolver"
+	"keepup-helm-scraper/src/rules"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SourceImage = "image"
+	SourceHelm  = "helm"
+	// the proxies of a service mesh, see Options.DetectMesh
+	SourceMesh = "mesh"
+	// the images of the manifests of Helm releases, see Options.ParseHelmManifests
+	SourceHelmManifest = "helm-manifest"
+)
+
+type HelmChartInfo struct {
+	ChartName      string            `json:"chart_name"`
+	Category       string            `json:"category,omitempty"`
+	Version        string            `json:"version"`
+	Namespace      string            `json:"namespace"`
+	Source         string            `json:"source"`
+	Confidence     string            `json:"confidence,omitempty"`
+	Registry       string            `json:"registry,omitempty"`
+	Repository     string            `json:"repository,omitempty"`
+	HelmRelease    string            `json:"helm_release,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	Sidecar        bool              `json:"sidecar,omitempty"`
+	Count          int64             `json:"count,omitempty"`
+	ContainerRoles []string          `json:"container_roles,omitempty"`
+	PullPolicies   []string          `json:"pull_policies,omitempty"`
+	ImageIDs       []string          `json:"image_ids,omitempty"`
+	Replicas       *ReplicaTotals    `json:"replicas,omitempty"`
+	Resources      *ResourceTotals   `json:"resources,omitempty"`
+}
+
+// SchemaVersion identifies the payload shape for the ingestion API,
+// bump it on changes the API can't parse with the previous version.
+const SchemaVersion = "1"
+
+type ClusterInfo struct {
+	SchemaVersion     string            `json:"schema_version"`
+	ClusterName       string            `json:"cluster_name"`
+	KubeVersion       string            `json:"kube_version"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	HelmCharts        []HelmChartInfo   `json:"helm_charts"`
+	ScannedNamespaces []string          `json:"scanned_namespaces,omitempty"`
+	VersionSkew       []VersionSkew     `json:"version_skew,omitempty"`
+	Downgrades        []Downgrade       `json:"downgrades,omitempty"`
+	UnmatchedRules    []string          `json:"unmatched_rules,omitempty"`
+	UnmatchedImages   []UnmatchedImage  `json:"unmatched_images,omitempty"`
+	Nodes             []NodeInfo        `json:"nodes,omitempty"`
+	Errors            []ScrapeError     `json:"errors,omitempty"`
+	Anomalies         []Anomaly         `json:"anomalies,omitempty"`
+	InvalidImages     []InvalidImage    `json:"invalid_images,omitempty"`
+
+	// UnmatchedImagesOmitted counts the unmatched images over MaxUnmatchedImages
+	UnmatchedImagesOmitted int `json:"unmatched_images_omitted,omitempty"`
+	// HelmChartsOmitted counts the detections over Options.ReportTopN
+	HelmChartsOmitted int `json:"helm_charts_omitted,omitempty"`
+
+	// Truncated is set when Options.MaxNamespaces or Options.MaxWorkloads
+	// stopped the scrape short, Truncation telling how far it got
+	Truncated  bool        `json:"truncated,omitempty"`
+	Truncation *Truncation `json:"truncation,omitempty"`
+}
+
+// Truncation counts what a truncated scrape covered of the cluster.
+type Truncation struct {
+	// Namespaces of the cluster and the ones scanned, the last one maybe partly
+	Namespaces        int `json:"namespaces"`
+	ScannedNamespaces int `json:"scanned_namespaces"`
+	// Workloads whose images were collected
+	Workloads int `json:"workloads"`
+}
+
+// VersionSkew is an application running at several versions in the cluster.
+type VersionSkew struct {
+	Application string   `json:"application"`
+	Versions    []string `json:"versions"`
+}
+
+// Stages of a scrape reported in ScrapeErrors, custom resources are
+// reported by their resource.group.
+const (
+	StageDeployments  = "deployments"
+	StageStatefulSets = "statefulsets"
+	StageDaemonSets   = "daemonsets"
+	StagePods         = "pods"
+	StageJobs         = "jobs"
+	StageNodes        = "nodes"
+	StageHelmReleases = "helm-releases"
+	StageHelmDecode   = "helm-decode"
+	StageHelmManifest = "helm-manifest"
+)
+
+// ScrapeError is a part of the cluster that couldn't be read, so the
+// report is partial: its absence means nothing is there, not a failure.
+type ScrapeError struct {
+	Namespace string `json:"namespace,omitempty"`
+	Stage     string `json:"stage"`
+	Message   string `json:"message"`
+}
+
+// Anomaly is a workload that was read but looks broken, f/e with no
+// containers in its pod template; worth investigating, not a scrape failure.
+type Anomaly struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+}
+
+// InvalidImage is a malformed image reference of a workload, f/e with a
+// space or an empty tag; it's reported instead of run through the rules.
+type InvalidImage struct {
+	Namespace string `json:"namespace"`
+	Image     string `json:"image"`
+	Reason    string `json:"reason"`
+}
+
+// UnmatchedImage is an image of a workload no rule matched.
+type UnmatchedImage struct {
+	Namespace string `json:"namespace"`
+	Image     string `json:"image"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+// MaxUnmatchedImages caps the unmatched images of a report, so a cluster
+// running mostly untracked images doesn't bloat the payload.
+const MaxUnmatchedImages = 1000
+
+// DetectedComponent is an application detected in a workload, or a
+// Helm release with Kind HelmRelease, passed to Options.OnDetection.
+type DetectedComponent struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Image     string
+	// ContainerRoles of the workload's containers running the image, once
+	// each, see rules.ContainerRole*; empty for Helm releases
+	ContainerRoles []string
+	// HelmRelease that deployed the workload, if any
+	HelmRelease string
+	Application string
+	Category    string
+	Version     string
+	// Confidence of the version, see rules.Confidence*
+	Confidence string
+}
+
+// Formats of ClusterInfo.KubeVersion, see Options.KubeVersionFormat.
+const (
+	KubeVersionRaw        = "raw"
+	KubeVersionSemVer     = "semver"
+	KubeVersionMajorMinor = "major-minor"
+)
+
+// Options configure a Scraper. The zero value scans nothing.
+type Options struct {
+	// ClusterName of the report; when empty it's read from the ConfigMap key
+	// in ClusterNameConfigMap (namespace/name/key), the kubeadm-config or
+	// the ClusterNameNodeLabel of a node, f/e alpha.eksctl.io/cluster-name.
+	ClusterName          string
+	ClusterNameConfigMap string
+	ClusterNameNodeLabel string
+	// KubeVersionFormat of the reported Kubernetes version, KubeVersionRaw
+	// when empty.
+	KubeVersionFormat string
+	// Labels tag the report, f/e with its environment and region.
+	Labels map[string]string
+	// Namespace to scan, all namespaces when empty.
+	Namespace string
+	// ScanImages detects applications from workload images by the rules,
+	// ScanHelm reports Helm releases.
+	ScanImages bool
+	ScanHelm   bool
+	// Kinds are the built-in workload kinds to scan for images, named
+	// like their stages: deployments, statefulsets and daemonsets; all
+	// of them when empty.
+	Kinds []string
+	// ScanCache, when set, keeps the workloads between the scrapes of a
+	// long-running scraper, so only changed ones are read; see ScanCache.
+	ScanCache *ScanCache
+	// MetadataCache, when set, keeps the cluster name and Kubernetes version
+	// between the scrapes of a long-running scraper; see MetadataCache.
+	MetadataCache *MetadataCache
+	// VersionHistory, when set, adds the applications running at a lower
+	// version than in the previous scrape to the report; see VersionHistory.
+	VersionHistory *VersionHistory
+	// CRDs are custom workload resources to scan for images, read
+	// with DynamicClient.
+	CRDs          []crd.Resource
+	DynamicClient dynamic.Interface
+	// JobLookback scans the Jobs created by CronJobs that started within it,
+	// reported as their CronJob, so images overridden in a run are seen;
+	// none are scanned when it's 0.
+	JobLookback time.Duration
+	// MaxNamespaces and MaxWorkloads stop a scrape short of giant clusters,
+	// marking the report Truncated; unlimited when 0. MaxWorkloads is
+	// checked before every list of workloads, so the one crossing it is kept.
+	MaxNamespaces int
+	MaxWorkloads  int
+	// HelmLabelSelector selects the Helm release secrets, releases last
+	// deployed longer than HelmMaxAge ago are skipped unless it's 0.
+	HelmLabelSelector string
+	HelmMaxAge        time.Duration
+	// HelmReleaseLabels are the keys of the annotations or labels naming the
+	// Helm release of a workload, the first one set wins;
+	// DefaultHelmReleaseLabels when empty.
+	HelmReleaseLabels []string
+	// HelmRules map charts to application names, the first matching
+	// rule wins; releases of other charts are reported as they are.
+	HelmRules []rules.HelmRule
+	// ParseHelmManifests runs the rules over the images of the manifests
+	// of the Helm releases as well.
+	ParseHelmManifests bool
+	// ImageLabels reads image labels from registries for rules with a
+	// versionLabel, with the pull secrets of the workloads; none when nil.
+	ImageLabels *registry.Client
+	// VersionResolver is run for the images no rule finds a version in,
+	// none when nil.
+	VersionResolver *resolver.Command
+	// SidecarContainers are container names or name prefixes of sidecars.
+	SidecarContainers []string
+	// ContainerNameFilter restricts the scanned containers, all when nil.
+	ContainerNameFilter *regexp.Regexp
+	// ExcludeApplications and ExcludeImages match the application names and
+	// image references to drop from the report, none when nil; see CompileGlobs.
+	ExcludeApplications *regexp.Regexp
+	ExcludeImages       *regexp.Regexp
+	// IncludeApplications keeps only the detections of the applications it
+	// matches in the report, all when nil; see ParseApplicationFilter.
+	IncludeApplications *regexp.Regexp
+	// RedactRegistries matches the registry hosts replaced by RedactedRegistry
+	// in the report, f/e ones whose names are confidential; see CompileGlobs.
+	RedactRegistries *regexp.Regexp
+	// CollectResources adds the summed requests and limits to detections,
+	// CollectImageIDs their pull policies and the image digests of running pods.
+	CollectResources bool
+	CollectImageIDs  bool
+	// CollectAnnotations are the keys of workload annotations added to the
+	// detections, f/e team or cost-center ones; others are never collected.
+	CollectAnnotations []string
+	// CollectNodes adds the software of every node to the report.
+	CollectNodes bool
+	// DetectMesh reports the Istio and Linkerd proxies injected into the
+	// pods, of their annotations rather than the rules.
+	DetectMesh bool
+	// ReportNamespaces adds the scanned namespaces, ReportVersionSkew the
+	// applications running at several versions, ReportUnmatchedRules
+	// the applications of rules matching no image and ReportUnmatchedImages
+	// the images of workloads matching no rule to the report.
+	ReportNamespaces      bool
+	ReportVersionSkew     bool
+	ReportUnmatchedRules  bool
+	ReportUnmatchedImages bool
+	// ReportTopN keeps only the N detections with the highest Count in the
+	// report, sorted by it, all when 0; see topCharts.
+	ReportTopN int
+	// OnDetection, when set, is called with every detection while scraping,
+	// f/e to stream them; it doesn't change what Scrape returns.
+	OnDetection func(context.Context, DetectedComponent)
+}
+
+// Scraper scrapes a single cluster.
+type Scraper struct {
+	client kubernetes.Interface
+	rules  []rules.Rule
+	opts   Options
+}
+
+func New(client kubernetes.Interface, rules []rules.Rule, opts Options) *Scraper {
+	return &Scraper{client: client, rules: rules, opts: opts}
+}
+
+// Scrape runs a full scrape of the cluster. Only failing to list the
+// namespaces fails it, other failures are reported in ClusterInfo.Errors.
+func (s *Scraper) Scrape(ctx context.Context) (ClusterInfo, error) {
+	namespaces, err := s.namespaces(ctx)
+	if err != nil {
+		return ClusterInfo{}, err
+	}
+	truncation := Truncation{Namespaces: len(namespaces)}
+	if s.opts.MaxNamespaces > 0 && len(namespaces) > s.opts.MaxNamespaces {
+		log.Printf("Scanning only the first %d of %d namespaces, MaxNamespaces is reached", s.opts.MaxNamespaces, len(namespaces))
+		namespaces = namespaces[:s.opts.MaxNamespaces]
+	}
+	truncation.ScannedNamespaces = len(namespaces)
+
+	var imagesInstalled []HelmChartInfo
+	var scrapeErrors []ScrapeError
+	var scan imageScan
+	if s.opts.ScanImages {
+		scan = s.scanImages(ctx, namespaces)
+		imagesInstalled = append(imagesInstalled, scan.charts...)
+		scrapeErrors = append(scrapeErrors, scan.errors...)
+		truncation.Workloads = scan.workloads
+		if scan.truncated {
+			// the namespaces after the one the workloads ran out in weren't scanned
+			namespaces = namespaces[:scan.scannedNamespaces]
+			truncation.ScannedNamespaces = scan.scannedNamespaces
+		}
+	}
+
+	if s.opts.ScanHelm {
+		releases, decodeErrors, err := helm.CollectReleases(ctx, s.client, helm.Options{
+			Namespace:     s.opts.Namespace,
+			LabelSelector: s.opts.HelmLabelSelector,
+			MaxAge:        s.opts.HelmMaxAge,
+			KeepManifests: s.opts.ParseHelmManifests,
+		})
+		if err != nil {
+			log.Printf("Failed to collect Helm releases: %v", err)
+			scrapeErrors = append(scrapeErrors, ScrapeError{
+				Namespace: s.opts.Namespace,
+				Stage:     StageHelmReleases,
+				Message:   err.Error(),
+			})
+		}
+		for _, e := range decodeErrors {
+			scrapeErrors = append(scrapeErrors, ScrapeError{
+				Namespace: e.Namespace,
+				Stage:     StageHelmDecode,
+				Message:   e.Error(),
+			})
+		}
+		for _, r := range releases {
+			name, version := DetectChart(r.Chart.Metadata.Name, r.Chart.Metadata.Version, s.opts.HelmRules)
+			if matchesAny(s.opts.ExcludeApplications, name) {
+				continue
+			}
+			if s.opts.OnDetection != nil {
+				s.opts.OnDetection(ctx, DetectedComponent{
+					Namespace:   r.Namespace,
+					Kind:        "HelmRelease",
+					Name:        r.Name,
+					HelmRelease: r.Name,
+					Application: name,
+					Version:     version,
+					Confidence:  rules.ConfidenceHigh,
+				})
+			}
+			imagesInstalled = append(imagesInstalled, HelmChartInfo{
+				ChartName:   name,
+				Version:     version,
+				Namespace:   r.Namespace,
+				Source:      SourceHelm,
+				Confidence:  rules.ConfidenceHigh,
+				HelmRelease: r.Name,
+			})
+		}
+		if s.opts.ParseHelmManifests {
+			charts, errs := s.scanHelmManifests(ctx, releases)
+			imagesInstalled = append(imagesInstalled, charts...)
+			scrapeErrors = append(scrapeErrors, errs...)
+		}
+	}
+
+	if s.opts.DetectMesh {
+		charts, errs := s.scanMesh(ctx, namespaces)
+		imagesInstalled = append(imagesInstalled, charts...)
+		scrapeErrors = append(scrapeErrors, errs...)
+	}
+
+	var nodes []NodeInfo
+	if s.opts.CollectNodes {
+		var err error
+		nodes, err = listNodes(ctx, s.client)
+		if err != nil {
+			log.Printf("Failed to list nodes: %v", err)
+			scrapeErrors = append(scrapeErrors, ScrapeError{Stage: StageNodes, Message: err.Error()})
+		}
+	}
+
+	imagesInstalled = dedupeCharts(imagesInstalled)
+	sortCharts(imagesInstalled)
+	if s.opts.IncludeApplications != nil {
+		imagesInstalled = slices.DeleteFunc(imagesInstalled, func(c HelmChartInfo) bool {
+			return !s.opts.IncludeApplications.MatchString(c.ChartName)
+		})
+	}
+
+	clusterName := s.opts.ClusterName
+	if clusterName == "" {
+		clusterName = s.opts.MetadataCache.get(metadataClusterName, func() (string, bool) {
+			return getClusterName(ctx, s.client, s.opts.ClusterNameConfigMap, s.opts.ClusterNameNodeLabel)
+		})
+	}
+
+	kubeVersion := s.opts.MetadataCache.get(metadataKubeVersion, func() (string, bool) {
+		return getKubernetesVersion(s.client, s.opts.KubeVersionFormat)
+	})
+
+	output := ClusterInfo{
+		SchemaVersion: SchemaVersion,
+		ClusterName:   clusterName,
+		KubeVersion:   kubeVersion,
+		Labels:        s.opts.Labels,
+		HelmCharts:    imagesInstalled,
+		Nodes:         nodes,
+		Errors:        scrapeErrors,
+		Anomalies:     scan.anomalies,
+		InvalidImages: scan.invalidImages,
+	}
+	if s.opts.ReportNamespaces {
+		output.ScannedNamespaces = namespaces
+	}
+	if s.opts.ReportVersionSkew {
+		output.VersionSkew = versionSkew(imagesInstalled)
+	}
+	if s.opts.VersionHistory != nil {
+		output.Downgrades = s.opts.VersionHistory.downgrades(imagesInstalled)
+	}
+	if s.opts.ReportUnmatchedRules {
+		output.UnmatchedRules = scan.unmatchedRules
+	}
+	if truncation.ScannedNamespaces < truncation.Namespaces || scan.truncated {
+		output.Truncated = true
+		output.Truncation = &truncation
+	}
+	if s.opts.ReportUnmatchedImages {
+		output.UnmatchedImages = scan.unmatchedImages
+		if len(output.UnmatchedImages) > MaxUnmatchedImages {
+			output.UnmatchedImagesOmitted = len(output.UnmatchedImages) - MaxUnmatchedImages
+			output.UnmatchedImages = output.UnmatchedImages[:MaxUnmatchedImages]
+		}
+	}
+	// after version skew and downgrades, which look at every detection
+	if s.opts.ReportTopN > 0 {
+		output.HelmCharts, output.HelmChartsOmitted = topCharts(output.HelmCharts, s.opts.ReportTopN)
+	}
+	// last, so the logs above show the real hosts
+	redactRegistries(&output, s.opts.RedactRegistries)
+	return output, nil
+}
+
+// RedactedRegistry replaces the registry hosts matching Options.RedactRegistries.
+const RedactedRegistry = "<internal>"
+
+// redactRegistries replaces the registry hosts matching the globs in the
+// report, keeping repositories and tags, so versions can still be tracked.
+func redactRegistries(info *ClusterInfo, globs *regexp.Regexp) {
+	if globs == nil {
+		return
+	}
+	for i, c := range info.HelmCharts {
+		if c.Registry != "" && matchesAny(globs, c.Registry) {
+			info.HelmCharts[i].Registry = RedactedRegistry
+		}
+	}
+	for i, img := range info.InvalidImages {
+		info.InvalidImages[i].Image = redactImage(img.Image, globs)
+	}
+	for i, img := range info.UnmatchedImages {
+		info.UnmatchedImages[i].Image = redactImage(img.Image, globs)
+	}
+}
+
+// redactImage replaces the registry host of the image reference if it
+// matches the globs.
+func redactImage(img string, globs *regexp.Regexp) string {
+	if ref := reference.Parse(img); ref.Registry != "" && matchesAny(globs, ref.Registry) {
+		return RedactedRegistry + strings.TrimPrefix(img, ref.Registry)
+	}
+	return img
+}
+
+// namespaces returns the namespaces to scan.
+func (s *Scraper) namespaces(ctx context.Context) ([]string, error) {
+	// a single target namespace needs no cluster-wide list permission
+	if s.opts.Namespace != "" {
+		return []string{s.opts.Namespace}, nil
+	}
+	namespaces, err := listNamespaces(ctx, s.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	return namespaces, nil
+}
+
+// dedupeCharts drops repeated entries with the same chart name, version,
+// namespace and source, keeping the first one.
+func dedupeCharts(charts []HelmChartInfo) []HelmChartInfo {
+	type chartKey struct {
+		ChartName, Version, Namespace, Source string
+	}
+
+	seen := make(map[chartKey]bool)
+	var result []HelmChartInfo
+	for _, c := range charts {
+		key := chartKey{c.ChartName, c.Version, c.Namespace, c.Source}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, c)
+	}
+	return result
+}
+
+// sortCharts orders the entries by namespace, chart name, version and source
+// so the payload is stable across runs.
+func sortCharts(charts []HelmChartInfo) {
+	slices.SortFunc(charts, func(a, b HelmChartInfo) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.ChartName, b.ChartName),
+			cmp.Compare(a.Version, b.Version),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+}
+
+// topCharts returns the n charts with the highest Count, the containers
+// running them, in descending order and the number of charts dropped.
+// Ties keep the order of sortCharts; Helm releases have no count, so
+// they come last.
+func topCharts(charts []HelmChartInfo, n int) ([]HelmChartInfo, int) {
+	slices.SortStableFunc(charts, func(a, b HelmChartInfo) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	if len(charts) <= n {
+		return charts, 0
+	}
+	log.Printf("Reporting only the %d most widespread of %d detections, ReportTopN is reached", n, len(charts))
+	return charts[:n], len(charts) - n
+}
+
+// versionSkew returns the applications with more than one distinct version,
+// with their versions in sort order.
+func versionSkew(charts []HelmChartInfo) []VersionSkew {
+	versions := make(map[string]map[string]bool)
+	for _, c := range charts {
+		if _, ok := versions[c.ChartName]; !ok {
+			versions[c.ChartName] = make(map[string]bool)
+		}
+		versions[c.ChartName][c.Version] = true
+	}
+
+	var skew []VersionSkew
+	for _, application := range slices.Sorted(maps.Keys(versions)) {
+		if len(versions[application]) > 1 {
+			skew = append(skew, VersionSkew{
+				Application: application,
+				Versions:    slices.Sorted(maps.Keys(versions[application])),
+			})
+		}
+	}
+	return skew
+}
+
+// CompileGlobs compiles the globs into a regex matching the whole values
+// one of them matches, * matching any text and ? a single character, once
+// for all the values checked against them. No globs return nil.
+func CompileGlobs(globs []string) *regexp.Regexp {
+	if len(globs) == 0 {
+		return nil
+	}
+	patterns := make([]string, len(globs))
+	for i, glob := range globs {
+		patterns[i] = globPattern(glob)
+	}
+	return regexp.MustCompile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+// matchesAny reports whether the globs of CompileGlobs match the value,
+// false for nil.
+func matchesAny(globs *regexp.Regexp, value string) bool {
+	return globs != nil && globs.MatchString(value)
+}
+
+// globPattern returns the regex of the glob.
+func globPattern(glob string) string {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	return strings.ReplaceAll(pattern, `\?`, ".")
+}
+
+// ParseApplicationFilter parses a filter of application names for
+// Options.IncludeApplications: a regex between slashes, f/e /^(postgres|mysql)/,
+// or else comma-separated globs like CompileGlobs takes, f/e postgres*,redis.
+// An empty filter returns nil.
+func ParseApplicationFilter(filter string) (*regexp.Regexp, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	if len(filter) > 1 && strings.HasPrefix(filter, "/") && strings.HasSuffix(filter, "/") {
+		return regexp.Compile(filter[1 : len(filter)-1])
+	}
+	var patterns []string
+	for _, glob := range strings.Split(filter, ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			patterns = append(patterns, globPattern(glob))
+		}
+	}
+	return regexp.Compile("^(?:" + strings.Join(patterns, "|") + ")$")
+}
+
+func listNamespaces(ctx context.Context, client kubernetes.Interface) ([]string, error) {
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	return names, nil
+}
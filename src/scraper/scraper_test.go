@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDedupeCharts(t *testing.T) {
+	charts := []HelmChartInfo{
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "shop", Source: SourceImage},
+		{ChartName: "redis", Version: "7.2.0", Namespace: "shop", Source: SourceHelm},
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "shop", Source: SourceImage},
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "shop", Source: SourceHelm},
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "blog", Source: SourceImage},
+		{ChartName: "nginx", Version: "1.26.0", Namespace: "shop", Source: SourceImage},
+		{ChartName: "redis", Version: "7.2.0", Namespace: "shop", Source: SourceHelm},
+	}
+	got := dedupeCharts(charts)
+	want := []HelmChartInfo{charts[0], charts[1], charts[3], charts[4], charts[5]}
+	if len(got) != len(want) {
+		t.Fatalf("dedupeCharts returned %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].ChartName != want[i].ChartName || got[i].Version != want[i].Version ||
+			got[i].Namespace != want[i].Namespace || got[i].Source != want[i].Source {
+			t.Errorf("dedupeCharts()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSortCharts(t *testing.T) {
+	want := []HelmChartInfo{
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "blog", Source: SourceImage},
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "shop", Source: SourceHelm},
+		{ChartName: "nginx", Version: "1.25.1", Namespace: "shop", Source: SourceImage},
+		{ChartName: "nginx", Version: "1.26.0", Namespace: "shop", Source: SourceImage},
+		{ChartName: "redis", Version: "7.2.0", Namespace: "shop", Source: SourceHelm},
+	}
+	// every order of the input sorts the same
+	for _, order := range [][]int{{0, 1, 2, 3, 4}, {4, 3, 2, 1, 0}, {2, 4, 0, 3, 1}, {1, 0, 4, 2, 3}} {
+		var charts []HelmChartInfo
+		for _, i := range order {
+			charts = append(charts, want[i])
+		}
+		sortCharts(charts)
+		if !slices.EqualFunc(charts, want, func(a, b HelmChartInfo) bool {
+			return a.ChartName == b.ChartName && a.Version == b.Version && a.Namespace == b.Namespace && a.Source == b.Source
+		}) {
+			t.Errorf("sortCharts of order %v = %+v, want %+v", order, charts, want)
+		}
+	}
+}
+
+func TestCompileGlobs(t *testing.T) {
+	globs := CompileGlobs([]string{"postgres*", "redis", "registry-?.internal", "a.b"})
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"postgres", true},
+		{"postgresql", true},
+		{"redis", true},
+		{"redis-exporter", false},
+		{"registry-1.internal", true},
+		{"registry-12.internal", false},
+		// the dot is no wildcard
+		{"axb", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matchesAny(globs, tt.value); got != tt.want {
+			t.Errorf("matchesAny(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+	if CompileGlobs(nil) != nil || matchesAny(nil, "redis") {
+		t.Error("no globs match a value")
+	}
+}
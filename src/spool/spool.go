@@ -0,0 +1,189 @@
+// Package spool keeps payloads the API didn't accept on disk, gzipped,
+// so a later run can send them: at-least-once delivery across CronJob runs.
+package spool
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encodings of the spooled payloads, which tell how to resend them.
+const (
+	EncodingJSON  = "json"
+	EncodingProto = "proto"
+)
+
+const (
+	fileSuffix = ".gz"
+	// subdirectory of the payloads the API rejected for good, kept for
+	// inspection instead of resent
+	rejectedDir = "rejected"
+)
+
+// Spool is a directory of failed payloads, holding at most MaxBytes of them.
+type Spool struct {
+	Dir      string
+	MaxBytes int64
+}
+
+// Save stores the payload of the encoding, dropping the oldest ones beyond
+// MaxBytes, rejected ones first.
+func (s Spool) Save(payload []byte, encoding string) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "." + encoding + fileSuffix
+	if err := os.WriteFile(filepath.Join(s.Dir, name), buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return s.trim()
+}
+
+// Flush sends the spooled payloads oldest first with their encoding and
+// deletes the sent ones. send reports whether a failure is worth retrying:
+// Flush stops at the first such one, the API is likely still down then,
+// and moves payloads failing otherwise, f/e rejected as malformed, to the
+// rejected subdirectory, so they don't hold up the ones after them.
+func (s Spool) Flush(send func(payload []byte, encoding string) (bool, error)) error {
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		payload, err := readGzip(file)
+		if err != nil {
+			log.Printf("Dropping unreadable spooled payload %s: %v", file, err)
+			os.Remove(file)
+			continue
+		}
+		if retryable, err := send(payload, encoding(file)); err != nil {
+			if retryable {
+				return fmt.Errorf("failed to resend %s: %w", filepath.Base(file), err)
+			}
+			log.Printf("Moving spooled payload %s to %s, it can't be sent: %v", filepath.Base(file), rejectedDir, err)
+			if err := s.reject(file); err != nil {
+				return err
+			}
+			continue
+		}
+		log.Printf("Resent spooled payload %s", filepath.Base(file))
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reject moves the payload to the rejected subdirectory.
+func (s Spool) reject(file string) error {
+	dir := filepath.Join(s.Dir, rejectedDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(file, filepath.Join(dir, filepath.Base(file)))
+}
+
+// trim removes the oldest payloads, the rejected ones first, until the
+// spool fits MaxBytes.
+func (s Spool) trim() error {
+	rejected, err := list(filepath.Join(s.Dir, rejectedDir))
+	if err != nil {
+		return err
+	}
+	pending, err := s.files()
+	if err != nil {
+		return err
+	}
+	files := append(rejected, pending...)
+
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		sizes[i] = info.Size()
+		total += sizes[i]
+	}
+
+	for i := 0; total > s.MaxBytes && i < len(files); i++ {
+		log.Printf("Spool exceeds %d bytes, dropping %s", s.MaxBytes, filepath.Base(files[i]))
+		if err := os.Remove(files[i]); err != nil {
+			return err
+		}
+		total -= sizes[i]
+	}
+	return nil
+}
+
+// files returns the spooled payloads to send, oldest first.
+func (s Spool) files() ([]string, error) {
+	return list(s.Dir)
+}
+
+// list returns the spooled payloads in dir, oldest first.
+func list(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileSuffix) {
+			continue
+		}
+		switch encoding(e.Name()) {
+		case EncodingJSON, EncodingProto:
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	// names are timestamps of equal length for the foreseeable future
+	slices.Sort(files)
+	return files, nil
+}
+
+// encoding returns the encoding of a spooled payload by its name,
+// <timestamp>.<encoding>.gz.
+func encoding(file string) string {
+	return strings.TrimPrefix(filepath.Ext(strings.TrimSuffix(file, fileSuffix)), ".")
+}
+
+func readGzip(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
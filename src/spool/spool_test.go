@@ -0,0 +1,75 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type sent struct {
+	payload  string
+	encoding string
+}
+
+func TestFlush(t *testing.T) {
+	s := Spool{Dir: t.TempDir(), MaxBytes: 1 << 20}
+	for _, p := range []sent{{"first", EncodingJSON}, {"malformed", EncodingJSON}, {"third", EncodingProto}} {
+		if err := s.Save([]byte(p.payload), p.encoding); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []sent
+	err := s.Flush(func(payload []byte, encoding string) (bool, error) {
+		got = append(got, sent{string(payload), encoding})
+		if string(payload) == "malformed" {
+			return false, errors.New("API request failed with status: 400")
+		}
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	// a rejected payload doesn't hold up the ones after it
+	want := []sent{{"first", EncodingJSON}, {"malformed", EncodingJSON}, {"third", EncodingProto}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Flush() sent %v, want %v", got, want)
+	}
+	if pending, _ := s.files(); len(pending) != 0 {
+		t.Errorf("Flush() left %v", pending)
+	}
+	rejected, _ := list(filepath.Join(s.Dir, rejectedDir))
+	if len(rejected) != 1 {
+		t.Fatalf("Flush() rejected %v, want the malformed payload", rejected)
+	}
+	if payload, err := readGzip(rejected[0]); err != nil || string(payload) != "malformed" {
+		t.Errorf("rejected payload = %q, %v; want malformed", payload, err)
+	}
+}
+
+func TestFlushStopsOnRetryableFailure(t *testing.T) {
+	s := Spool{Dir: t.TempDir(), MaxBytes: 1 << 20}
+	for _, payload := range []string{"first", "second"} {
+		if err := s.Save([]byte(payload), EncodingJSON); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	attempts := 0
+	err := s.Flush(func([]byte, string) (bool, error) {
+		attempts++
+		return true, errors.New("API request failed with status: 503")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Flush() = %v after %d attempts, want an error after 1", err, attempts)
+	}
+	if pending, _ := s.files(); len(pending) != 2 {
+		t.Errorf("Flush() left %d payloads, want 2", len(pending))
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, rejectedDir)); !os.IsNotExist(err) {
+		t.Errorf("Flush() rejected payloads of a retryable failure")
+	}
+}
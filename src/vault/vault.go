@@ -0,0 +1,176 @@
+// Package vault reads a secret from a HashiCorp Vault KV engine over the
+// Vault HTTP API, logging in with a token or the Kubernetes auth method.
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the service account token the Kubernetes auth method logs in with
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Options locate the secret and say how to log in.
+type Options struct {
+	Addr string
+	// Token logs in directly, else Role with the Kubernetes auth method
+	// mounted at AuthMount
+	Token     string
+	Role      string
+	AuthMount string
+	// Path of the secret, f/e secret/data/keepup for a KV v2 engine mounted
+	// at secret or kv/keepup for a KV v1 one, and the key of the value
+	Path string
+	Key  string
+	// TTL the value is cached for before it's read again
+	TTL time.Duration
+}
+
+// Secret is a value read from Vault, cached for the TTL so a rotated secret
+// is picked up without a restart.
+type Secret struct {
+	opts Options
+	http *http.Client
+
+	mu      sync.Mutex
+	token   string
+	value   string
+	expires time.Time
+}
+
+func NewSecret(opts Options) *Secret {
+	return &Secret{
+		opts:  opts,
+		http:  &http.Client{Timeout: 10 * time.Second},
+		token: opts.Token,
+	}
+}
+
+// Value returns the cached value, reading it from Vault once the TTL passed.
+func (s *Secret) Value() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.value != "" && time.Now().Before(s.expires) {
+		return s.value, nil
+	}
+
+	value, err := s.read()
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusForbidden && s.opts.Token == "" {
+		// the login token expired, log in again once
+		s.token = ""
+		value, err = s.read()
+	}
+	if err != nil {
+		return "", err
+	}
+	s.value = value
+	s.expires = time.Now().Add(s.opts.TTL)
+	return value, nil
+}
+
+// read reads the value of the secret, logging in first without a token.
+func (s *Secret) read() (string, error) {
+	if s.token == "" {
+		token, err := s.login()
+		if err != nil {
+			return "", fmt.Errorf("login: %w", err)
+		}
+		s.token = token
+	}
+
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := s.do(http.MethodGet, s.opts.Path, nil, &resp); err != nil {
+		return "", err
+	}
+
+	data := resp.Data
+	// KV v2 nests the secret in data.data next to its metadata
+	if nested, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		data = nested
+	}
+	value, ok := data[s.opts.Key].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("no %s in %s", s.opts.Key, s.opts.Path)
+	}
+	return value, nil
+}
+
+// login logs in with the service account token and returns the client token.
+func (s *Secret) login() (string, error) {
+	jwt, err := os.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]string{
+		"role": s.opts.Role,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := s.do(http.MethodPost, "auth/"+s.opts.AuthMount+"/login", body, &resp); err != nil {
+		return "", err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("no client token for role %s", s.opts.Role)
+	}
+	return resp.Auth.ClientToken, nil
+}
+
+// do makes a request to the Vault API and decodes the JSON response into v.
+func (s *Secret) do(method, path string, body []byte, v any) error {
+	url := strings.TrimSuffix(s.opts.Addr, "/") + "/v1/" + strings.TrimPrefix(path, "/")
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Vault errors are {"errors":[...]}, short enough to pass on
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{
+			request: method + " " + path,
+			code:    resp.StatusCode,
+			message: string(bytes.TrimSpace(msg)),
+		}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusError is a response of the Vault API other than 200 OK.
+type statusError struct {
+	request string
+	code    int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: status %d: %s", e.request, e.code, e.message)
+}